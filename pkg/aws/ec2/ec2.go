@@ -16,7 +16,9 @@ package ec2
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/cilium/cilium/pkg/api/helpers"
 	eniTypes "github.com/cilium/cilium/pkg/aws/eni/types"
@@ -401,6 +403,82 @@ func (c *Client) AttachNetworkInterface(ctx context.Context, index int64, instan
 	return *attachResp.AttachmentId, nil
 }
 
+// ErrENILimitReached is returned by AttachNetworkInterfaceWithLimits when the
+// instance has reached the maximum number of adapters for its instance type
+// and no further ENI can be attached.
+var ErrENILimitReached = errors.New("instance is at its ENI adapter limit")
+
+// ErrIPLimitReached is returned by AttachNetworkInterfaceWithLimits when the
+// number of IPv4 addresses requested for the ENI exceeds the per-adapter
+// address limit of the instance type.
+var ErrIPLimitReached = errors.New("requested IPs exceed the per-adapter limit")
+
+// AttachNetworkInterfaceWithLimits attaches a previously created ENI to an
+// instance after verifying the attachment stays within the given instance
+// type limits. It returns an error wrapping ErrENILimitReached when the
+// instance already has attachedENIs adapters out of its limit, and one
+// wrapping ErrIPLimitReached when requestedIPv4 addresses (primary plus
+// secondary) would not fit on a single adapter; either refusal is issued
+// before any EC2 API call, which is cheaper and more specific than the
+// rejection AWS would return. A zero requestedIPv4 skips the address check.
+// The limits are accepted as input so callers can source them from the
+// instance-type limits table or from the EC2 API.
+func (c *Client) AttachNetworkInterfaceWithLimits(ctx context.Context, index int64, instanceID, eniID string,
+	limits ipamTypes.Limits, attachedENIs, requestedIPv4 int) (string, error) {
+
+	if limits.Adapters > 0 && attachedENIs >= limits.Adapters {
+		return "", fmt.Errorf("%w: instance %s already has %d of %d adapters attached",
+			ErrENILimitReached, instanceID, attachedENIs, limits.Adapters)
+	}
+
+	if limits.IPv4 > 0 && requestedIPv4 > limits.IPv4 {
+		return "", fmt.Errorf("%w: %d IPv4 addresses requested for ENI %s, limit is %d per adapter",
+			ErrIPLimitReached, requestedIPv4, eniID, limits.IPv4)
+	}
+
+	return c.AttachNetworkInterface(ctx, index, instanceID, eniID)
+}
+
+// VerifyInterfaceAttachment confirms via DescribeInstances that the given ENI
+// appears among the instance's attachments. Even after the attachment call
+// succeeded, the instance description may not reflect the new interface yet
+// due to eventual consistency, so the check is retried until the interface
+// shows up or ctx expires. It is intended as an optional, secondary
+// verification after an attachment has been confirmed on the ENI itself.
+func (c *Client) VerifyInterfaceAttachment(ctx context.Context, instanceID, eniID string) error {
+	for {
+		c.limiter.Limit(ctx, "DescribeInstances")
+		describeReq := &ec2.DescribeInstancesInput{
+			InstanceIds: []string{instanceID},
+		}
+
+		sinceStart := spanstat.Start()
+		listReq := c.ec2Client.DescribeInstancesRequest(describeReq)
+		response, err := listReq.Send(ctx)
+		c.metricsAPI.ObserveAPICall("DescribeInstances", deriveStatus(listReq.Request, err), sinceStart.Seconds())
+		if err != nil {
+			return err
+		}
+
+		for _, reservation := range response.Reservations {
+			for _, instance := range reservation.Instances {
+				for _, iface := range instance.NetworkInterfaces {
+					if iface.NetworkInterfaceId != nil && *iface.NetworkInterfaceId == eniID {
+						return nil
+					}
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("ENI %s not reflected in attachments of instance %s: %w",
+				eniID, instanceID, ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
 // ModifyNetworkInterface modifies the attributes of an ENI
 func (c *Client) ModifyNetworkInterface(ctx context.Context, eniID, attachmentID string, deleteOnTermination bool) error {
 	changes := &ec2.NetworkInterfaceAttachmentChanges{
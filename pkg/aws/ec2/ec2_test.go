@@ -17,11 +17,15 @@
 package ec2
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
 
+	ipamTypes "github.com/cilium/cilium/pkg/ipam/types"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 )
@@ -114,3 +118,22 @@ func TestNewSubnetsFilters(t *testing.T) {
 		})
 	}
 }
+
+func TestAttachNetworkInterfaceWithLimits(t *testing.T) {
+	// Both refusal paths return before any EC2 API call, so a zero-value
+	// client is sufficient.
+	client := &Client{}
+	limits := ipamTypes.Limits{Adapters: 4, IPv4: 15}
+
+	_, err := client.AttachNetworkInterfaceWithLimits(context.Background(), 1, "i-1234", "eni-1",
+		limits, 4, 0)
+	if !errors.Is(err, ErrENILimitReached) {
+		t.Fatalf("expected ErrENILimitReached, got %v", err)
+	}
+
+	_, err = client.AttachNetworkInterfaceWithLimits(context.Background(), 1, "i-1234", "eni-1",
+		limits, 1, 16)
+	if !errors.Is(err, ErrIPLimitReached) {
+		t.Fatalf("expected ErrIPLimitReached, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/cilium/cilium/pkg/lock"
+)
+
+// crdReconcileRecord is the audit record emitted per reconciled CRD when an
+// audit writer is registered. The JSON field names are part of the external
+// interface consumed by log ingestion pipelines and must remain stable.
+type crdReconcileRecord struct {
+	// Name is the metadata.name of the reconciled CRD.
+	Name string `json:"name"`
+
+	// Action is the reconcile action taken: "create", "update", "none",
+	// "skip" or "paused".
+	Action string `json:"action"`
+
+	// FromVersion is the schema version found on the cluster CRD before
+	// reconciliation, or empty if the CRD did not exist or carried no
+	// schema version label.
+	FromVersion string `json:"fromVersion,omitempty"`
+
+	// ToVersion is the compiled-in schema version being reconciled to.
+	ToVersion string `json:"toVersion"`
+
+	// InstalledVersion is the schema version observed on the cluster CRD
+	// after a successful reconcile. It can differ from ToVersion when a
+	// newer CRD was left untouched.
+	InstalledVersion string `json:"installedVersion,omitempty"`
+
+	// DurationMs is the total duration of the reconcile including the
+	// establishment wait, in milliseconds.
+	DurationMs int64 `json:"durationMs"`
+
+	// Error is the error which failed the reconcile, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// finalVersion returns the schema version the CRD carries after the recorded
+// action, preferring the version actually observed on the cluster after a
+// successful reconcile. CRDs which were not written, e.g. skipped or paused
+// ones, keep the version found in the cluster.
+func (r *crdReconcileRecord) finalVersion() string {
+	if r.InstalledVersion != "" {
+		return r.InstalledVersion
+	}
+	switch r.Action {
+	case "skip", "paused", "none":
+		if r.FromVersion != "" {
+			return r.FromVersion
+		}
+	}
+	return r.ToVersion
+}
+
+var (
+	// reconcileAuditMutex serializes writes to reconcileAuditWriter since
+	// the CRDs are reconciled concurrently.
+	reconcileAuditMutex lock.Mutex
+
+	// reconcileAuditWriter receives one JSON-encoded crdReconcileRecord
+	// line per reconciled CRD, if set.
+	reconcileAuditWriter io.Writer
+)
+
+// SetReconcileAuditWriter registers a writer which receives a single
+// machine-parsable JSON log line per CRD reconciled by
+// CreateCustomResourceDefinitions, describing the reconcile plan and outcome.
+// Passing nil disables audit emission.
+func SetReconcileAuditWriter(w io.Writer) {
+	reconcileAuditMutex.Lock()
+	reconcileAuditWriter = w
+	reconcileAuditMutex.Unlock()
+}
+
+// emitReconcileAudit writes the given record to the registered audit writer
+// as a single JSON line. Emission failures are logged but never fail the
+// reconcile itself.
+func emitReconcileAudit(record *crdReconcileRecord) {
+	reconcileAuditMutex.Lock()
+	defer reconcileAuditMutex.Unlock()
+
+	if reconcileAuditWriter == nil {
+		return
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.WithError(err).Warning("Unable to encode CRD reconcile audit record")
+		return
+	}
+
+	if _, err := reconcileAuditWriter.Write(append(data, '\n')); err != nil {
+		log.WithError(err).Warning("Unable to write CRD reconcile audit record")
+	}
+}
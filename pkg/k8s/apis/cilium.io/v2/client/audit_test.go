@@ -0,0 +1,61 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+
+	ciliumv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	. "gopkg.in/check.v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+)
+
+func (s *CiliumV2RegisterSuite) TestReconcileAuditRecords(c *C) {
+	var buf bytes.Buffer
+	SetReconcileAuditWriter(&buf)
+	defer SetReconcileAuditWriter(nil)
+
+	crd := s.mustConstructCNPCRD(c)
+
+	clusterCRD := crd.DeepCopy()
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+	clusterCRD.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{
+			Type:   apiextensionsv1beta1.Established,
+			Status: apiextensionsv1beta1.ConditionTrue,
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(clusterCRD)
+	c.Assert(createUpdateCRD(clientset, CNPCRDName, crd), IsNil)
+
+	var record crdReconcileRecord
+	c.Assert(json.Unmarshal(buf.Bytes(), &record), IsNil)
+	c.Assert(record.Name, Equals, crd.ObjectMeta.Name)
+	c.Assert(record.Action, Equals, "update")
+	c.Assert(record.FromVersion, Equals, "0.9")
+	c.Assert(record.ToVersion, Equals, ciliumv2.CustomResourceDefinitionSchemaVersion)
+	c.Assert(record.Error, Equals, "")
+
+	// An up-to-date CRD yields a "none" record.
+	buf.Reset()
+	c.Assert(createUpdateCRD(clientset, CNPCRDName, crd), IsNil)
+	c.Assert(json.Unmarshal(buf.Bytes(), &record), IsNil)
+	c.Assert(record.Action, Equals, "none")
+}
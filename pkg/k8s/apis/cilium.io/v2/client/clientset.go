@@ -0,0 +1,50 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+
+	ciliumv2client "github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/typed/cilium.io/v2"
+
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+)
+
+// Clientset bundles the typed Cilium client with the apiextensions client
+// needed for CRD installation. Callers that both install the CRDs and then
+// operate on the resulting custom resources can wire a single object through
+// instead of threading two clients everywhere.
+type Clientset struct {
+	ciliumv2client.CiliumV2Interface
+
+	apiextensions apiextensionsclient.Interface
+}
+
+// NewClientset bundles the given clients. Both must be non-nil.
+func NewClientset(ciliumClient ciliumv2client.CiliumV2Interface,
+	apiextensionsClient apiextensionsclient.Interface) *Clientset {
+
+	return &Clientset{
+		CiliumV2Interface: ciliumClient,
+		apiextensions:     apiextensionsClient,
+	}
+}
+
+// EnsureCRDs installs or updates the managed Cilium CRDs using the bundled
+// apiextensions client. It must succeed before the embedded typed client can
+// be used against a fresh cluster.
+func (c *Clientset) EnsureCRDs(ctx context.Context) error {
+	return CreateCustomResourceDefinitions(ctx, c.apiextensions)
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CRDInstallMetrics records the duration and outcome of CRD installation.
+// Implementations must be safe for concurrent use, as the managed CRDs are
+// reconciled concurrently.
+type CRDInstallMetrics interface {
+	// ObserveInstallDuration records the duration in seconds of the full
+	// create/update/wait cycle of the named CRD.
+	ObserveInstallDuration(crdName string, seconds float64)
+
+	// IncInstallError counts a failed CRD installation. The phase is one
+	// of "create", "update" or "wait".
+	IncInstallError(crdName, phase string)
+}
+
+// noopCRDInstallMetrics discards all observations. It is the default so that
+// users of this package, including unit tests, do not need a live Prometheus
+// registry.
+type noopCRDInstallMetrics struct{}
+
+func (noopCRDInstallMetrics) ObserveInstallDuration(crdName string, seconds float64) {}
+func (noopCRDInstallMetrics) IncInstallError(crdName, phase string)                  {}
+
+// crdInstallMetrics is the recorder used during CRD reconciliation.
+var crdInstallMetrics CRDInstallMetrics = noopCRDInstallMetrics{}
+
+// SetCRDInstallMetrics sets the recorder used during CRD reconciliation.
+// Passing nil reverts to the no-op recorder.
+func SetCRDInstallMetrics(m CRDInstallMetrics) {
+	if m == nil {
+		m = noopCRDInstallMetrics{}
+	}
+	crdInstallMetrics = m
+}
+
+// prometheusCRDInstallMetrics implements CRDInstallMetrics on top of a
+// Prometheus registry.
+type prometheusCRDInstallMetrics struct {
+	installDuration *prometheus.HistogramVec
+	installErrors   *prometheus.CounterVec
+}
+
+// NewPrometheusCRDInstallMetrics builds a CRDInstallMetrics recorder exposing
+// cilium_crd_install_duration_seconds and cilium_crd_install_errors_total and
+// registers its collectors with the given registry.
+func NewPrometheusCRDInstallMetrics(registry prometheus.Registerer) (CRDInstallMetrics, error) {
+	m := &prometheusCRDInstallMetrics{
+		installDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "cilium",
+			Name:      "crd_install_duration_seconds",
+			Help:      "Duration in seconds of the create/update/wait cycle of a managed CRD",
+			Buckets:   []float64{.25, .5, 1, 2.5, 5, 10, 15, 30, 45, 60},
+		}, []string{"crd_name"}),
+		installErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cilium",
+			Name:      "crd_install_errors_total",
+			Help:      "Total number of failed CRD installations by phase",
+		}, []string{"crd_name", "phase"}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.installDuration, m.installErrors} {
+		if err := registry.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *prometheusCRDInstallMetrics) ObserveInstallDuration(crdName string, seconds float64) {
+	m.installDuration.WithLabelValues(crdName).Observe(seconds)
+}
+
+func (m *prometheusCRDInstallMetrics) IncInstallError(crdName, phase string) {
+	m.installErrors.WithLabelValues(crdName, phase).Inc()
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	. "gopkg.in/check.v1"
+)
+
+func (s *CiliumV2RegisterSuite) TestCRDInstallMetrics(c *C) {
+	defer SetCRDInstallMetrics(nil)
+
+	registry := prometheus.NewRegistry()
+	recorder, err := NewPrometheusCRDInstallMetrics(registry)
+	c.Assert(err, IsNil)
+	SetCRDInstallMetrics(recorder)
+
+	clientset := s.newEstablishingClientset()
+	c.Assert(CreateCustomResourceDefinitions(context.TODO(), clientset), IsNil)
+
+	metricFamilies, err := registry.Gather()
+	c.Assert(err, IsNil)
+
+	durations := 0
+	for _, family := range metricFamilies {
+		if family.GetName() == "cilium_crd_install_duration_seconds" {
+			durations = len(family.GetMetric())
+		}
+	}
+	// One histogram series per installed CRD.
+	c.Assert(durations >= 4, Equals, true)
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	k8sconstv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	"github.com/cilium/cilium/pkg/lock"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"sigs.k8s.io/yaml"
+)
+
+// CRDSource provides the raw pregenerated CRD objects which the construct
+// functions normalize before installation. The default source reads the
+// go-bindata-embedded assets; air-gapped environments which patch CRD
+// schemas post-build can substitute a filesystem source.
+type CRDSource interface {
+	// CRD returns the pregenerated CRD for the given CRD name (CNPCRDName
+	// et al.).
+	CRD(crdName string) (apiextensionsv1beta1.CustomResourceDefinition, error)
+}
+
+// crdSource is the active source of pregenerated CRDs. Nil selects the
+// embedded assets.
+var crdSource CRDSource
+
+// SetCRDSource overrides where the pregenerated CRDs are loaded from.
+// Passing nil reverts to the embedded go-bindata assets.
+func SetCRDSource(source CRDSource) {
+	crdSource = source
+}
+
+// activeCRDSource returns the source registered via SetCRDSource, or the
+// embedded one.
+func activeCRDSource() CRDSource {
+	if crdSource != nil {
+		return crdSource
+	}
+	return embeddedCRDSource{}
+}
+
+// embeddedCRDSource reads the pregenerated CRDs from the go-bindata-embedded
+// examples. It is the default source.
+type embeddedCRDSource struct{}
+
+var (
+	// embeddedCRDCacheMutex guards embeddedCRDCache.
+	embeddedCRDCacheMutex lock.Mutex
+
+	// embeddedCRDCache holds the parsed embedded CRDs by CRD name. The
+	// embedded assets never change at runtime, so the YAML parse, which is
+	// non-trivial for the larger schemas, only needs to run once per CRD
+	// instead of on every reconcile. Callers receive deep copies; the
+	// cached objects are never handed out directly.
+	embeddedCRDCache = map[string]*apiextensionsv1beta1.CustomResourceDefinition{}
+)
+
+func (embeddedCRDSource) CRD(crdName string) (apiextensionsv1beta1.CustomResourceDefinition, error) {
+	embeddedCRDCacheMutex.Lock()
+	cached, ok := embeddedCRDCache[crdName]
+	embeddedCRDCacheMutex.Unlock()
+	if ok {
+		return *cached.DeepCopy(), nil
+	}
+
+	var (
+		err      error
+		crdBytes []byte
+	)
+
+	ciliumCRD := apiextensionsv1beta1.CustomResourceDefinition{}
+
+	switch crdName {
+	case CNPCRDName:
+		crdBytes, err = examplesCrdsCiliumnetworkpoliciesYamlBytes()
+	case CCNPCRDName:
+		crdBytes, err = examplesCrdsCiliumclusterwidenetworkpoliciesYamlBytes()
+	case CEPCRDName:
+		crdBytes, err = examplesCrdsCiliumendpointsYamlBytes()
+	case CIDCRDName:
+		crdBytes, err = examplesCrdsCiliumidentitiesYamlBytes()
+	case CNCRDName:
+		crdBytes, err = examplesCrdsCiliumnodesYamlBytes()
+	default:
+		return ciliumCRD, fmt.Errorf("pregenerated CRD %q does not exist", crdName)
+	}
+
+	if err != nil {
+		return ciliumCRD, fmt.Errorf("unable to retrieve pregenerated CRD %s: %w", crdName, err)
+	}
+
+	if err := yaml.Unmarshal(crdBytes, &ciliumCRD); err != nil {
+		return ciliumCRD, fmt.Errorf("unable to unmarshal pregenerated CRD %s: %w", crdName, err)
+	}
+
+	embeddedCRDCacheMutex.Lock()
+	embeddedCRDCache[crdName] = ciliumCRD.DeepCopy()
+	embeddedCRDCacheMutex.Unlock()
+
+	return ciliumCRD, nil
+}
+
+// crdFileNames maps each CRD name to the YAML file a DirectoryCRDSource
+// expects, matching the basenames of the embedded examples/crds assets.
+var crdFileNames = map[string]string{
+	CNPCRDName:  "ciliumnetworkpolicies.yaml",
+	CCNPCRDName: "ciliumclusterwidenetworkpolicies.yaml",
+	CEPCRDName:  "ciliumendpoints.yaml",
+	CIDCRDName:  "ciliumidentities.yaml",
+	CNCRDName:   "ciliumnodes.yaml",
+}
+
+// DirectoryCRDSource loads the pregenerated CRDs from YAML files in a
+// directory, using the same file names as the embedded examples/crds assets.
+type DirectoryCRDSource struct {
+	// Dir is the directory containing the CRD YAML files.
+	Dir string
+}
+
+func (s DirectoryCRDSource) CRD(crdName string) (apiextensionsv1beta1.CustomResourceDefinition, error) {
+	ciliumCRD := apiextensionsv1beta1.CustomResourceDefinition{}
+
+	fileName, ok := crdFileNames[crdName]
+	if !ok {
+		return ciliumCRD, fmt.Errorf("pregenerated CRD %q does not exist", crdName)
+	}
+
+	path := filepath.Join(s.Dir, fileName)
+	crdBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ciliumCRD, fmt.Errorf("unable to read CRD %s from %s: %w", crdName, path, err)
+	}
+
+	if err := yaml.Unmarshal(crdBytes, &ciliumCRD); err != nil {
+		return ciliumCRD, fmt.Errorf("unable to unmarshal CRD %s from %s: %w", crdName, path, err)
+	}
+
+	// A patched file must still be a CRD of the Cilium API group; catch
+	// accidentally dropped-in foreign manifests before they reach the
+	// construct functions.
+	if ciliumCRD.Spec.Group != k8sconstv2.CustomResourceDefinitionGroup {
+		return ciliumCRD, fmt.Errorf("CRD %s loaded from %s belongs to group %q, expected %q",
+			crdName, path, ciliumCRD.Spec.Group, k8sconstv2.CustomResourceDefinitionGroup)
+	}
+
+	return ciliumCRD, nil
+}
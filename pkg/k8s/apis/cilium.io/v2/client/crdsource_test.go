@@ -0,0 +1,159 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"sigs.k8s.io/yaml"
+)
+
+func (s *CiliumV2RegisterSuite) TestDirectoryCRDSource(c *C) {
+	defer SetCRDSource(nil)
+
+	dir := c.MkDir()
+
+	// Seed the directory with a patched copy of the embedded CNP asset.
+	embedded, err := GetPregeneratedCRD(CNPCRDName)
+	c.Assert(err, IsNil)
+	embedded.Spec.Names.ShortNames = append(embedded.Spec.Names.ShortNames, "patchedcnp")
+	data, err := yaml.Marshal(embedded)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "ciliumnetworkpolicies.yaml"), data, 0644), IsNil)
+
+	SetCRDSource(DirectoryCRDSource{Dir: dir})
+
+	loaded, err := GetPregeneratedCRD(CNPCRDName)
+	c.Assert(err, IsNil)
+	c.Assert(loaded.Spec.Names.ShortNames, DeepEquals, embedded.Spec.Names.ShortNames)
+
+	// CRDs without a file in the directory fail instead of silently
+	// falling back to the embedded assets.
+	_, err = GetPregeneratedCRD(CEPCRDName)
+	c.Assert(err, ErrorMatches, ".*unable to read CRD.*")
+
+	// A foreign manifest dropped into the directory is rejected.
+	foreign := embedded.DeepCopy()
+	foreign.Spec.Group = "example.com"
+	data, err = yaml.Marshal(foreign)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "ciliumnetworkpolicies.yaml"), data, 0644), IsNil)
+
+	_, err = GetPregeneratedCRD(CNPCRDName)
+	c.Assert(err, ErrorMatches, `.*belongs to group "example.com".*`)
+}
+
+// TestEmbeddedCRDCache verifies callers of the embedded source get
+// independent copies, so mutating one does not corrupt later reads.
+func (s *CiliumV2RegisterSuite) TestEmbeddedCRDCache(c *C) {
+	first, err := GetPregeneratedCRD(CNPCRDName)
+	c.Assert(err, IsNil)
+
+	plural := first.Spec.Names.Plural
+	first.Spec.Names.Plural = "mutated"
+	first.Spec.Validation = nil
+
+	second, err := GetPregeneratedCRD(CNPCRDName)
+	c.Assert(err, IsNil)
+	c.Assert(second.Spec.Names.Plural, Equals, plural)
+	c.Assert(second.Spec.Validation, NotNil)
+}
+
+// foreignGroupCRDSource returns a CRD of a non-Cilium API group, emulating a
+// fork which swapped in an incompatible template.
+type foreignGroupCRDSource struct{}
+
+func (foreignGroupCRDSource) CRD(crdName string) (apiextensionsv1beta1.CustomResourceDefinition, error) {
+	crd, err := embeddedCRDSource{}.CRD(crdName)
+	if err != nil {
+		return crd, err
+	}
+	crd.Spec.Group = "example.com"
+	return crd, nil
+}
+
+// TestGetPregeneratedCRDGroupValidation verifies templates from a foreign API
+// group are rejected on load, regardless of the source.
+func (s *CiliumV2RegisterSuite) TestGetPregeneratedCRDGroupValidation(c *C) {
+	defer SetCRDSource(nil)
+	SetCRDSource(foreignGroupCRDSource{})
+
+	_, err := GetPregeneratedCRD(CNPCRDName)
+	c.Assert(err, ErrorMatches, `.*belongs to group "example.com", expected "cilium.io"`)
+
+	_, err = constructCNPCRD()
+	c.Assert(err, NotNil)
+}
+
+// printerColumnCRDSource injects a printer column and a status subresource
+// into every template, emulating a future regeneration of the assets.
+type printerColumnCRDSource struct{}
+
+func (printerColumnCRDSource) CRD(crdName string) (apiextensionsv1beta1.CustomResourceDefinition, error) {
+	crd, err := embeddedCRDSource{}.CRD(crdName)
+	if err != nil {
+		return crd, err
+	}
+	crd.Spec.AdditionalPrinterColumns = append(crd.Spec.AdditionalPrinterColumns,
+		apiextensionsv1beta1.CustomResourceColumnDefinition{
+			Name:     "Age",
+			Type:     "date",
+			JSONPath: ".metadata.creationTimestamp",
+		})
+	crd.Spec.Subresources = &apiextensionsv1beta1.CustomResourceSubresources{
+		Status: &apiextensionsv1beta1.CustomResourceSubresourceStatus{},
+	}
+	return crd, nil
+}
+
+// TestConstructsPreservePrinterColumns verifies every construct function maps
+// the template's printer columns and subresources onto the installed CRD, so
+// a regenerated asset gaining either does not silently lose them.
+func (s *CiliumV2RegisterSuite) TestConstructsPreservePrinterColumns(c *C) {
+	defer SetCRDSource(nil)
+	SetCRDSource(printerColumnCRDSource{})
+
+	for _, construct := range managedCRDs() {
+		crd, err := construct()
+		c.Assert(err, IsNil)
+
+		template, err := GetPregeneratedCRD(crdNameForMetaName(c, crd.ObjectMeta.Name))
+		c.Assert(err, IsNil)
+		c.Assert(crd.Spec.AdditionalPrinterColumns, DeepEquals,
+			template.Spec.AdditionalPrinterColumns,
+			Commentf("printer columns dropped for %s", crd.ObjectMeta.Name))
+		c.Assert(crd.Spec.Subresources, NotNil,
+			Commentf("subresources dropped for %s", crd.ObjectMeta.Name))
+	}
+}
+
+// crdNameForMetaName maps a CRD metadata name back to the Kind/version name
+// used for template lookup.
+func crdNameForMetaName(c *C, metaName string) string {
+	for _, crdName := range []string{CNPCRDName, CCNPCRDName, CEPCRDName, CIDCRDName, CNCRDName} {
+		crd, err := GetPregeneratedCRD(crdName)
+		c.Assert(err, IsNil)
+		if crd.ObjectMeta.Name == metaName {
+			return crdName
+		}
+	}
+	c.Fatalf("no template for CRD %s", metaName)
+	return ""
+}
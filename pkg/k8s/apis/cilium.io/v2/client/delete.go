@@ -0,0 +1,106 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cilium/cilium/pkg/option"
+
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// DeleteCRDsOptions configures DeleteCustomResourceDefinitions.
+type DeleteCRDsOptions struct {
+	// Wait blocks until the deleted CRD objects have actually disappeared
+	// from the apiserver, bounded per CRD by the poll timeout.
+	Wait bool
+
+	// Poll configures the interval and timeout of the disappearance wait.
+	// Nil applies the defaults.
+	Poll *CRDPollConfig
+}
+
+// DeleteCustomResourceDefinitions removes every CRD managed by this package
+// from the cluster, including the identity CRD regardless of the identity
+// allocation mode. CRDs which do not exist are treated as already deleted.
+// This is the teardown counterpart to CreateCustomResourceDefinitions, meant
+// for uninstallation and CI cleanup; deleting a CRD also deletes all custom
+// resources of that type.
+func DeleteCustomResourceDefinitions(ctx context.Context, clientset apiextensionsclient.Interface,
+	opts DeleteCRDsOptions) error {
+
+	// Querying the canonical name list in CRD allocation mode includes the
+	// identity CRD unconditionally, which is what a teardown wants.
+	var names []string
+	for _, crdName := range ListCiliumCRDNames(option.IdentityAllocationModeCRD) {
+		crd, err := crdConstructFor(crdName)()
+		if err != nil {
+			return err
+		}
+		names = append(names, crd.ObjectMeta.Name)
+	}
+
+	propagationPolicy := metav1.DeletePropagationForeground
+	for _, name := range names {
+		err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Delete(
+			ctx,
+			name,
+			metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete CRD %s: %w", name, err)
+		}
+	}
+
+	if !opts.Wait {
+		return nil
+	}
+
+	for _, name := range names {
+		if err := waitForCRDDeleted(ctx, clientset, name, opts.Poll); err != nil {
+			return fmt.Errorf("unable to confirm deletion of CRD %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// waitForCRDDeleted polls until the named CRD is no longer present in the
+// apiserver, or until the poll timeout or ctx expires.
+func waitForCRDDeleted(ctx context.Context, clientset apiextensionsclient.Interface,
+	name string, poll *CRDPollConfig) error {
+
+	waitCtx, cancel := context.WithTimeout(ctx, poll.timeout())
+	defer cancel()
+
+	err := poll.poll(waitCtx, func() (bool, error) {
+		_, getErr := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+			waitCtx,
+			name,
+			metav1.GetOptions{})
+		if errors.IsNotFound(getErr) {
+			return true, nil
+		}
+		return false, getErr
+	})
+	if err == wait.ErrWaitTimeout && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"context"
+
+	. "gopkg.in/check.v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (s *CiliumV2RegisterSuite) TestDeleteCustomResourceDefinitions(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	err := CreateCustomResourceDefinitions(context.TODO(), clientset)
+	c.Assert(err, IsNil)
+
+	// Deleting the installed CRDs empties the cluster; CRDs which are
+	// already gone (e.g. the identity CRD in KVstore mode) do not fail
+	// the teardown.
+	err = DeleteCustomResourceDefinitions(context.TODO(), clientset, DeleteCRDsOptions{Wait: true})
+	c.Assert(err, IsNil)
+
+	crds, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().List(
+		context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(crds.Items, HasLen, 0)
+
+	// A second run against the empty cluster is a no-op.
+	err = DeleteCustomResourceDefinitions(context.TODO(), clientset, DeleteCRDsOptions{})
+	c.Assert(err, IsNil)
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/pmezard/go-difflib/difflib"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"sigs.k8s.io/yaml"
+)
+
+// DiffCRDSchema returns a human-readable unified diff of the validation
+// schemas of the desired and the cluster CRD, with the cluster schema as the
+// base. An empty string means the schemas are identical. When a CRD is
+// updated on every reconcile, the diff pinpoints the field causing the churn
+// instead of leaving operators to eyeball two multi-thousand-line schemas.
+func DiffCRDSchema(desired, cluster *apiextensionsv1beta1.CustomResourceDefinition) (string, error) {
+	clusterYAML, err := yaml.Marshal(cluster.Spec.Validation)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal cluster CRD schema: %w", err)
+	}
+
+	desiredYAML, err := yaml.Marshal(desired.Spec.Validation)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal desired CRD schema: %w", err)
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(clusterYAML)),
+		B:        difflib.SplitLines(string(desiredYAML)),
+		FromFile: "cluster",
+		ToFile:   "desired",
+		Context:  3,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to diff CRD schemas: %w", err)
+	}
+
+	return diff, nil
+}
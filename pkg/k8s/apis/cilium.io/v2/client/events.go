@@ -0,0 +1,70 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// CRDInstalledReason is the event reason emitted when a CRD is created.
+	CRDInstalledReason = "CRDInstalled"
+
+	// CRDUpdatedReason is the event reason emitted when an existing CRD is
+	// updated to a new schema.
+	CRDUpdatedReason = "CRDUpdated"
+)
+
+// CRDEventRecorder is the subset of the client-go record.EventRecorder
+// interface used for CRD install events. A real recorder satisfies it
+// structurally, keeping this package free of the recorder machinery.
+type CRDEventRecorder interface {
+	Event(object runtime.Object, eventtype, reason, message string)
+}
+
+var (
+	// crdEventRecorder, when non-nil, receives a Normal event for every
+	// CRD this package creates or updates. Disabled by default.
+	crdEventRecorder CRDEventRecorder
+
+	// crdEventObject is the involved object the events are attached to,
+	// e.g. the agent pod. Events need an object to hang off; without one
+	// no events are emitted.
+	crdEventObject runtime.Object
+)
+
+// SetCRDEventRecorder wires an event recorder and the involved object, e.g.
+// the agent pod, into CRD reconciliation. Every created CRD emits a Normal
+// CRDInstalled event and every updated one a CRDUpdated event, naming the
+// CRD and its schema version, giving operators watching cluster events an
+// audit trail without scraping logs. Passing a nil recorder or object
+// disables emission, which is the default.
+func SetCRDEventRecorder(recorder CRDEventRecorder, involved runtime.Object) {
+	crdEventRecorder = recorder
+	crdEventObject = involved
+}
+
+// emitCRDEvent emits a Normal event for a reconciled CRD when a recorder is
+// configured.
+func emitCRDEvent(reason, crdName, schemaVersion string) {
+	if crdEventRecorder == nil || crdEventObject == nil {
+		return
+	}
+	crdEventRecorder.Event(crdEventObject, corev1.EventTypeNormal, reason,
+		fmt.Sprintf("CRD %s (schema version %s)", crdName, schemaVersion))
+}
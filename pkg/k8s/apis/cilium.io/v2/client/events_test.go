@@ -0,0 +1,86 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"context"
+
+	. "gopkg.in/check.v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	ciliumv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+)
+
+// capturedEvent is one event observed by recordingEventRecorder.
+type capturedEvent struct {
+	eventtype, reason, message string
+}
+
+// recordingEventRecorder captures emitted events for assertions.
+type recordingEventRecorder struct {
+	events []capturedEvent
+}
+
+func (r *recordingEventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.events = append(r.events, capturedEvent{eventtype, reason, message})
+}
+
+func (s *CiliumV2RegisterSuite) TestCRDEventRecorder(c *C) {
+	defer SetCRDEventRecorder(nil, nil)
+
+	recorder := &recordingEventRecorder{}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cilium-abc", Namespace: "kube-system"}}
+	SetCRDEventRecorder(recorder, pod)
+
+	clientset := s.newEstablishingClientset()
+
+	// Creating a CRD emits CRDInstalled.
+	_, err := ReconcileCRDs(context.Background(), clientset, ReconcileOptions{
+		Filter: []string{CNPCRDName},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(recorder.events, HasLen, 1)
+	c.Assert(recorder.events[0].eventtype, Equals, corev1.EventTypeNormal)
+	c.Assert(recorder.events[0].reason, Equals, CRDInstalledReason)
+	c.Assert(recorder.events[0].message, Matches, "CRD ciliumnetworkpolicies.cilium.io .*")
+
+	// Downgrading the schema version label triggers an update, emitting
+	// CRDUpdated.
+	clusterCRD, err := getClusterCRD(clientset, ciliumv2.CNPName)
+	c.Assert(err, IsNil)
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+	_, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Update(
+		context.TODO(), clusterCRD, metav1.UpdateOptions{})
+	c.Assert(err, IsNil)
+
+	_, err = ReconcileCRDs(context.Background(), clientset, ReconcileOptions{
+		Filter: []string{CNPCRDName},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(recorder.events, HasLen, 2)
+	c.Assert(recorder.events[1].reason, Equals, CRDUpdatedReason)
+
+	// An unchanged CRD emits nothing, as does a disabled recorder.
+	SetCRDEventRecorder(nil, nil)
+	_, err = ReconcileCRDs(context.Background(), clientset, ReconcileOptions{
+		Filter: []string{CNPCRDName},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(recorder.events, HasLen, 2)
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ExportManagedCRDs writes all CRDs managed by the agent to w as a YAML
+// stream, with each document separated by "---". The exported objects are
+// identical to what CreateCustomResourceDefinitions installs into the
+// cluster, including the identity CRD being subject to the identity
+// allocation and CRD modes, which allows transitioning from agent-managed to
+// GitOps-managed CRDs with an exact copy. The documents are emitted in a
+// stable order so consecutive exports diff cleanly.
+func ExportManagedCRDs(w io.Writer) error {
+	crds := managedCRDs()
+	names := make([]string, 0, len(crds))
+	for name := range crds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		crd, err := crds[name]()
+		if err != nil {
+			return err
+		}
+
+		crd.TypeMeta = metav1.TypeMeta{
+			APIVersion: apiextensionsv1beta1.SchemeGroupVersion.String(),
+			Kind:       "CustomResourceDefinition",
+		}
+
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+
+		crdBytes, err := yaml.Marshal(crd)
+		if err != nil {
+			return fmt.Errorf("unable to marshal CRD %s: %s", crd.ObjectMeta.Name, err)
+		}
+		if _, err := w.Write(crdBytes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"sigs.k8s.io/yaml"
+)
+
+func (s *CiliumV2RegisterSuite) TestExportManagedCRDs(c *C) {
+	var buf bytes.Buffer
+
+	c.Assert(ExportManagedCRDs(&buf), IsNil)
+
+	// Under the default kvstore identity allocation mode the identity CRD
+	// is not managed, so it is not exported either.
+	docs := strings.Split(buf.String(), "\n---\n")
+	c.Assert(docs, HasLen, 4)
+
+	names := make(map[string]struct{})
+	for _, doc := range docs {
+		crd := apiextensionsv1beta1.CustomResourceDefinition{}
+		c.Assert(yaml.Unmarshal([]byte(doc), &crd), IsNil)
+		c.Assert(crd.Kind, Equals, "CustomResourceDefinition")
+		c.Assert(crd.APIVersion, Equals, apiextensionsv1beta1.SchemeGroupVersion.String())
+		names[crd.Name] = struct{}{}
+	}
+	c.Assert(names, HasLen, 4)
+
+	// With the identity CRD forced on, the export includes it, mirroring
+	// the create path.
+	defer SetIdentityCRDMode(IdentityCRDAuto)
+	c.Assert(SetIdentityCRDMode(IdentityCRDAlways), IsNil)
+
+	buf.Reset()
+	c.Assert(ExportManagedCRDs(&buf), IsNil)
+	c.Assert(strings.Split(buf.String(), "\n---\n"), HasLen, 5)
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// crdGroupOverride, when non-empty, replaces the cilium.io API group in every
+// CRD this package installs. Forks running alongside upstream Cilium use it
+// to avoid claiming the same cluster-scoped CRD names. It is off by default
+// and only affects the installed objects; the embedded templates keep the
+// upstream group.
+var crdGroupOverride string
+
+// SetCRDGroupOverride installs a replacement API group for the managed CRDs.
+// The group must be a valid DNS subdomain; passing the empty string reverts
+// to the upstream cilium.io group. The override must be set before any CRDs
+// are reconciled — changing it afterwards orphans the objects installed under
+// the previous group.
+func SetCRDGroupOverride(group string) error {
+	if group != "" {
+		if errs := validation.IsDNS1123Subdomain(group); len(errs) > 0 {
+			return fmt.Errorf("CRD group override %q is not a valid DNS subdomain: %s",
+				group, strings.Join(errs, ", "))
+		}
+	}
+	crdGroupOverride = group
+	return nil
+}
+
+// applyGroupOverride rewrites the CRD's group and, to keep the
+// <plural>.<group> invariant, its metadata name. It is a no-op unless an
+// override is configured.
+func applyGroupOverride(crd *apiextensionsv1beta1.CustomResourceDefinition) {
+	if crdGroupOverride == "" {
+		return
+	}
+	crd.Spec.Group = crdGroupOverride
+	crd.ObjectMeta.Name = crd.Spec.Names.Plural + "." + crdGroupOverride
+}
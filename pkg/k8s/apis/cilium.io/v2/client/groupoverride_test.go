@@ -0,0 +1,56 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"context"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *CiliumV2RegisterSuite) TestSetCRDGroupOverride(c *C) {
+	c.Assert(SetCRDGroupOverride("Not_A_Subdomain!"), ErrorMatches,
+		".*is not a valid DNS subdomain.*")
+	// A rejected override leaves the default in place.
+	crd, err := constructCNPCRD()
+	c.Assert(err, IsNil)
+	c.Assert(crd.Spec.Group, Equals, "cilium.io")
+}
+
+func (s *CiliumV2RegisterSuite) TestCRDGroupOverride(c *C) {
+	defer SetCRDGroupOverride("")
+	c.Assert(SetCRDGroupOverride("cilium.example.com"), IsNil)
+
+	// Every managed CRD moves to the override group with a consistent
+	// metadata name, so validateCRDName still passes.
+	for _, construct := range managedCRDs() {
+		crd, err := construct()
+		c.Assert(err, IsNil)
+		c.Assert(crd.Spec.Group, Equals, "cilium.example.com")
+		c.Assert(crd.ObjectMeta.Name, Equals,
+			crd.Spec.Names.Plural+".cilium.example.com")
+		c.Assert(validateCRDName(crd), IsNil)
+	}
+
+	// The full reconcile installs the CRDs under the override group.
+	clientset := s.newEstablishingClientset()
+	c.Assert(CreateCustomResourceDefinitions(context.Background(), clientset), IsNil)
+
+	crd, err := getClusterCRD(clientset, "ciliumnetworkpolicies.cilium.example.com")
+	c.Assert(err, IsNil)
+	c.Assert(crd.Spec.Group, Equals, "cilium.example.com")
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sort"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// CRDStatus is the health of a single managed CRD as observed by CRDHealth.
+type CRDStatus struct {
+	// Name is the metadata.name of the CRD.
+	Name string
+
+	// Installed reports whether the CRD exists in the cluster.
+	Installed bool
+
+	// UpToDate reports whether the installed CRD's schema is at least as
+	// new as this agent's compiled-in version.
+	UpToDate bool
+
+	// Established reports whether the CRD carries an Established condition
+	// with status True, i.e. the apiserver is serving the resource.
+	Established bool
+}
+
+// CRDHealth reports the drift of every managed CRD from the desired schema
+// version without performing any updates. It is cheap enough to poll from a
+// health endpoint and strictly side-effect free; the results are sorted by
+// CRD name. A CRD which is missing from the cluster is reported rather than
+// treated as an error.
+func CRDHealth(ctx context.Context, clientset apiextensionsclient.Interface) ([]CRDStatus, error) {
+	statuses := make([]CRDStatus, 0, len(managedCRDs()))
+	for _, construct := range managedCRDs() {
+		crd, err := construct()
+		if err != nil {
+			return nil, err
+		}
+
+		status := CRDStatus{Name: crd.ObjectMeta.Name}
+
+		clusterCRD, err := getClusterCRD(clientset, crd.ObjectMeta.Name)
+		switch {
+		case errors.IsNotFound(err):
+			statuses = append(statuses, status)
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		status.Installed = true
+		status.UpToDate = !needsUpdate(crd, clusterCRD)
+		for _, cond := range clusterCRD.Status.Conditions {
+			if cond.Type == apiextensionsv1beta1.Established &&
+				cond.Status == apiextensionsv1beta1.ConditionTrue {
+				status.Established = true
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	return statuses, nil
+}
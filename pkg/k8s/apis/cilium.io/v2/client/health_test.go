@@ -0,0 +1,77 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"context"
+
+	ciliumv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	. "gopkg.in/check.v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestCRDHealth covers the side-effect-free drift probe over the managed
+// CRDs.
+func (s *CiliumV2RegisterSuite) TestCRDHealth(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	// Nothing installed yet.
+	statuses, err := CRDHealth(context.TODO(), clientset)
+	c.Assert(err, IsNil)
+	c.Assert(len(statuses) > 0, Equals, true)
+	for _, status := range statuses {
+		c.Assert(status.Installed, Equals, false)
+	}
+
+	_, err = ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{})
+	c.Assert(err, IsNil)
+
+	statuses, err = CRDHealth(context.TODO(), clientset)
+	c.Assert(err, IsNil)
+	for _, status := range statuses {
+		c.Assert(status.Installed, Equals, true)
+		c.Assert(status.UpToDate, Equals, true)
+		c.Assert(status.Established, Equals, true)
+	}
+
+	// An outdated schema version shows up as drift, and probing must not
+	// repair it.
+	crd := s.mustConstructCNPCRD(c)
+	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+	_, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Update(
+		context.TODO(), clusterCRD, metav1.UpdateOptions{})
+	c.Assert(err, IsNil)
+
+	statuses, err = CRDHealth(context.TODO(), clientset)
+	c.Assert(err, IsNil)
+	for _, status := range statuses {
+		if status.Name == crd.ObjectMeta.Name {
+			c.Assert(status.Installed, Equals, true)
+			c.Assert(status.UpToDate, Equals, false)
+		} else {
+			c.Assert(status.UpToDate, Equals, true)
+		}
+	}
+
+	clusterCRD, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey], Equals, "0.9")
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cilium/cilium/pkg/lock"
+
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+)
+
+// MultiClusterInstallConfig configures InstallCRDsMultiCluster.
+type MultiClusterInstallConfig struct {
+	// MaxParallel bounds how many clusters are reconciled concurrently.
+	// Zero or a negative value reconciles all clusters at once.
+	MaxParallel int
+}
+
+// InstallCRDsMultiCluster runs CreateCustomResourceDefinitions against each
+// named cluster concurrently and returns the per-cluster result, keyed by the
+// same cluster names as the given clients. A nil result value means the CRDs
+// of that cluster are installed and established. Cancelling ctx aborts the
+// installs still in flight, e.g. when a single unreachable cluster would
+// otherwise block for the full per-CRD poll timeout, with the affected
+// clusters reporting the cancellation as their result.
+func InstallCRDsMultiCluster(ctx context.Context, clients map[string]apiextensionsclient.Interface,
+	cfg MultiClusterInstallConfig) map[string]error {
+
+	results := make(map[string]error, len(clients))
+
+	var sem chan struct{}
+	if cfg.MaxParallel > 0 {
+		sem = make(chan struct{}, cfg.MaxParallel)
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mutex lock.Mutex
+	)
+	for name, clientset := range clients {
+		wg.Add(1)
+		go func(name string, clientset apiextensionsclient.Interface) {
+			defer wg.Done()
+
+			if sem != nil {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+			}
+
+			err := CreateCustomResourceDefinitions(ctx, clientset)
+
+			mutex.Lock()
+			results[name] = err
+			mutex.Unlock()
+		}(name, clientset)
+	}
+	wg.Wait()
+
+	return results
+}
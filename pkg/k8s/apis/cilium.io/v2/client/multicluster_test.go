@@ -0,0 +1,72 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"context"
+
+	. "gopkg.in/check.v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newEstablishingClientset returns a fake clientset whose created CRDs report
+// the Established condition immediately, so that the establishment wait of
+// createUpdateCRD does not time out against the fake.
+func (s *CiliumV2RegisterSuite) newEstablishingClientset() *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			crd := action.(k8stesting.CreateAction).GetObject().(*apiextensionsv1beta1.CustomResourceDefinition)
+			crd.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+				{
+					Type:   apiextensionsv1beta1.Established,
+					Status: apiextensionsv1beta1.ConditionTrue,
+				},
+			}
+			return false, nil, nil
+		})
+	return clientset
+}
+
+func (s *CiliumV2RegisterSuite) TestInstallCRDsMultiCluster(c *C) {
+	clients := map[string]*fake.Clientset{
+		"cluster-1": s.newEstablishingClientset(),
+		"cluster-2": s.newEstablishingClientset(),
+	}
+
+	installClients := make(map[string]apiextensionsclient.Interface, len(clients))
+	for name, clientset := range clients {
+		installClients[name] = clientset
+	}
+
+	results := InstallCRDsMultiCluster(context.Background(), installClients, MultiClusterInstallConfig{MaxParallel: 1})
+	c.Assert(results, HasLen, 2)
+
+	for name, clientset := range clients {
+		c.Assert(results[name], IsNil)
+
+		crds, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().List(
+			context.TODO(), metav1.ListOptions{})
+		c.Assert(err, IsNil)
+		c.Assert(len(crds.Items) >= 4, Equals, true)
+	}
+}
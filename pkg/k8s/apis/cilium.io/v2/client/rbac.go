@@ -0,0 +1,38 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// RequiredCRDRBAC returns the RBAC policy rules required by
+// CreateCustomResourceDefinitions, i.e. the exact verbs createUpdateCRD uses
+// against customresourcedefinitions. Tooling can render the result into a
+// least-privilege Role manifest which stays in sync with the code's actual
+// requirements. The function is pure and performs no cluster calls.
+func RequiredCRDRBAC() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{"apiextensions.k8s.io"},
+			Resources: []string{"customresourcedefinitions"},
+			// get covers the reads of createUpdateCRD and its
+			// establishment wait; create, update and delete cover
+			// installation, schema upgrades and the cleanup of a CRD
+			// which failed to establish.
+			Verbs: []string{"get", "create", "update", "delete"},
+		},
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"time"
+
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+)
+
+// ReadinessGateConfig configures the optional apiserver readiness gate run
+// before CRD installation begins.
+type ReadinessGateConfig struct {
+	// Retries is the number of readiness probes attempted before giving
+	// up. Defaults to 5 when zero.
+	Retries int
+
+	// RetryInterval is the delay between readiness probes. Defaults to
+	// one second when zero.
+	RetryInterval time.Duration
+}
+
+// apiserverReadinessGate holds the readiness gate configuration registered
+// via SetAPIServerReadinessGate, if any.
+var apiserverReadinessGate *ReadinessGateConfig
+
+// SetAPIServerReadinessGate enables a readiness check of the apiserver before
+// CreateCustomResourceDefinitions begins creating CRDs, so that an agent
+// starting while the control plane is still coming up waits instead of
+// failing on a transient startup error. Passing nil disables the gate, which
+// is the default.
+func SetAPIServerReadinessGate(cfg *ReadinessGateConfig) {
+	apiserverReadinessGate = cfg
+}
+
+// waitForAPIServerReady probes the apiserver with a trivial discovery call
+// until it responds or the configured retries are exhausted. It is a no-op
+// when no readiness gate is configured.
+func waitForAPIServerReady(clientset apiextensionsclient.Interface) error {
+	cfg := apiserverReadinessGate
+	if cfg == nil {
+		return nil
+	}
+
+	retries := cfg.Retries
+	if retries <= 0 {
+		retries = 5
+	}
+	interval := cfg.RetryInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var err error
+	for attempt := 0; attempt < retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(interval)
+		}
+
+		if _, err = clientset.Discovery().ServerVersion(); err == nil {
+			return nil
+		}
+
+		log.WithError(err).Info("apiserver is not ready yet, retrying...")
+	}
+
+	return fmt.Errorf("apiserver is not ready after %d attempts: %s", retries, err)
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+)
+
+func (s *CiliumV2RegisterSuite) TestAPIServerReadinessGate(c *C) {
+	clientset := fake.NewSimpleClientset()
+
+	// Without a configured gate the check is a no-op.
+	c.Assert(waitForAPIServerReady(clientset), IsNil)
+
+	SetAPIServerReadinessGate(&ReadinessGateConfig{
+		Retries:       2,
+		RetryInterval: 10 * time.Millisecond,
+	})
+	defer SetAPIServerReadinessGate(nil)
+
+	c.Assert(waitForAPIServerReady(clientset), IsNil)
+}
@@ -0,0 +1,542 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	k8sconstv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	k8sversion "github.com/cilium/cilium/pkg/k8s/version"
+	"github.com/cilium/cilium/pkg/lock"
+	"github.com/cilium/cilium/pkg/option"
+
+	"golang.org/x/sync/errgroup"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// CRDPollConfig configures the polling behavior of CRD reconciliation, i.e.
+// the waits for establishment and deletion. On large clusters with a slow
+// apiserver the default timeout may not be enough for a CRD to become
+// Established, in which case a newly created CRD would be deleted again;
+// operators can raise the timeout per environment instead of recompiling.
+type CRDPollConfig struct {
+	// Interval is the time between polls of the CRD status. Defaults to
+	// 500ms when zero.
+	Interval time.Duration
+
+	// Timeout bounds each wait for CRD establishment or deletion.
+	// Defaults to 60s when zero.
+	Timeout time.Duration
+
+	// BackoffFactor, when greater than 1, grows the poll interval
+	// exponentially from Interval up to MaxInterval, with jitter. This
+	// spreads the Get traffic of many agents polling simultaneously,
+	// e.g. during a mass rollout, instead of hammering the apiserver at
+	// a fixed uniform rate. Zero keeps the fixed-interval poll.
+	BackoffFactor float64
+
+	// MaxInterval caps the backed-off poll interval. Defaults to 5s when
+	// zero.
+	MaxInterval time.Duration
+}
+
+// interval returns the configured poll interval with the default applied.
+// It accepts a nil config.
+func (cfg *CRDPollConfig) interval() time.Duration {
+	if cfg != nil && cfg.Interval > 0 {
+		return cfg.Interval
+	}
+	return 500 * time.Millisecond
+}
+
+// timeout returns the configured poll timeout with the default applied. It
+// accepts a nil config.
+func (cfg *CRDPollConfig) timeout() time.Duration {
+	if cfg != nil && cfg.Timeout > 0 {
+		return cfg.Timeout
+	}
+	return 60 * time.Second
+}
+
+// maxInterval returns the configured backoff interval cap with the default
+// applied. It accepts a nil config.
+func (cfg *CRDPollConfig) maxInterval() time.Duration {
+	if cfg != nil && cfg.MaxInterval > 0 {
+		return cfg.MaxInterval
+	}
+	return 5 * time.Second
+}
+
+// poll runs conditionFn until it succeeds, returns an error or ctx is done,
+// in which case wait.ErrWaitTimeout is returned. Taking a context rather
+// than a bare channel lets callers cancel an in-flight wait, e.g. on agent
+// shutdown, without waiting out the poll timeout. Like
+// wait.PollImmediateUntil the condition runs once before the first sleep.
+// With a BackoffFactor configured the sleep grows exponentially with jitter
+// up to MaxInterval; the total elapsed time remains bounded by the
+// context's deadline.
+func (cfg *CRDPollConfig) poll(ctx context.Context, conditionFn wait.ConditionFunc) error {
+	if cfg == nil || cfg.BackoffFactor <= 1 {
+		return wait.PollImmediateUntil(cfg.interval(), conditionFn, ctx.Done())
+	}
+
+	interval := cfg.interval()
+	for {
+		if ok, err := conditionFn(); err != nil || ok {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return wait.ErrWaitTimeout
+		case <-time.After(wait.Jitter(interval, 0.1)):
+		}
+
+		interval = time.Duration(float64(interval) * cfg.BackoffFactor)
+		if max := cfg.maxInterval(); interval > max {
+			interval = max
+		}
+	}
+}
+
+// ReconcileOptions configures ReconcileCRDs.
+type ReconcileOptions struct {
+	// Filter restricts reconciliation to the CRDs with the given names
+	// (CNPCRDName et al.). An empty filter reconciles all managed CRDs.
+	Filter []string
+
+	// Poll configures the interval and timeout of the establishment and
+	// deletion waits. Nil applies the defaults.
+	Poll *CRDPollConfig
+
+	// DryRun computes the per-CRD actions without persisting anything. The
+	// create and update calls are issued with server-side dry-run
+	// (metav1.DryRunAll), so admission and validation still run against
+	// the apiserver; the establishment wait is skipped.
+	DryRun bool
+
+	// CreateOnly creates missing CRDs but never updates existing ones,
+	// for clusters where CRDs are owned out-of-band, e.g. by Helm, and the
+	// agent must not fight over them. The update check is skipped
+	// entirely, so schema drift on an existing CRD is not reconciled; the
+	// establishment wait still applies to both existing and newly created
+	// CRDs.
+	CreateOnly bool
+
+	// DeleteOnFailure deletes a CRD which this invocation created when its
+	// establishment wait fails, so that a retry starts from a clean slate.
+	// By default a newly created CRD is left in place on timeout: on a
+	// temporarily overloaded apiserver the CRD is usually valid and will
+	// establish eventually, and deleting it would also stop the serving of
+	// any custom resources stored under it.
+	DeleteOnFailure bool
+
+	// ExtraLabels are merged into the labels of every installed CRD, e.g.
+	// app.kubernetes.io/managed-by for GitOps inventory tooling. The
+	// reserved schema version label cannot be overridden; a collision is
+	// rejected before anything is mutated in the cluster.
+	ExtraLabels map[string]string
+
+	// ExtraAnnotations are merged into the annotations of every installed
+	// CRD.
+	ExtraAnnotations map[string]string
+
+	// Owner, when non-nil, is attached to every installed CRD as an
+	// owner reference so that deleting the owner garbage-collects the
+	// CRDs. The owner must be cluster-scoped; CRDs are cluster-scoped and
+	// cannot be owned by namespaced objects.
+	Owner *CRDOwner
+
+	// MaxStartupDelay, when non-zero, sleeps a random duration up to the
+	// given maximum before the first apiserver call of each CRD reconcile.
+	// When hundreds of agents restart simultaneously they otherwise race
+	// to create the same CRDs, flooding the apiserver with AlreadyExists
+	// and Conflict traffic; a jittered delay staggers them naturally. The
+	// delay only matters in large clusters and is aborted promptly when
+	// the context is cancelled. Where available, running the CRD install
+	// under leader election is the better fix. Defaults to zero, i.e. no
+	// delay.
+	MaxStartupDelay time.Duration
+
+	// Parallelism bounds the number of CRDs reconciled concurrently.
+	// Defaults to 4 when zero. With a client-side rate limit the requests
+	// of an unbounded fan-out get throttled and serialized anyway, at the
+	// cost of noisy retry logs; a small bound smooths the apiserver load
+	// instead.
+	Parallelism int
+
+	// ExtraPrinterColumns are merged into the additionalPrinterColumns of
+	// every installed CRD, e.g. a downstream fork surfacing a custom field
+	// in kubectl get output. Columns are deduplicated by name, an extra
+	// column replacing an embedded one of the same name; the embedded
+	// columns are preserved otherwise.
+	ExtraPrinterColumns []apiextensionsv1beta1.CustomResourceColumnDefinition
+
+	// Conversion, when non-nil, attaches a Webhook conversion strategy
+	// with the given client config to every installed CRD, required once
+	// multiple versions of a CRD are served simultaneously. When nil, an
+	// explicit None strategy is installed instead of leaving the field
+	// unset.
+	Conversion *CRDConversion
+
+	// ServerSideApply reconciles existing CRDs with server-side apply
+	// instead of the optimistic Get+Update cycle, surfacing conflicts
+	// explicitly. It is only honored when the apiserver supports it; on
+	// older apiservers the update path is used regardless.
+	ServerSideApply bool
+
+	// serverSideApplySupported caches the result of the apiserver
+	// capability probe for the duration of one reconcile fan-out, so that
+	// installing five CRDs evaluates the capability once rather than per
+	// CRD. Nil means not yet resolved; direct callers of reconcileCRD
+	// fall back to probing on demand.
+	serverSideApplySupported *bool
+}
+
+// serverSideApplyCapable reports whether server-side apply may be used,
+// consulting the cached capability when ReconcileCRDs resolved it up front
+// and probing k8sversion.Capabilities otherwise.
+func (o *ReconcileOptions) serverSideApplyCapable() bool {
+	if !o.ServerSideApply {
+		return false
+	}
+	if o.serverSideApplySupported == nil {
+		supported := k8sversion.Capabilities().ServerSideApply
+		o.serverSideApplySupported = &supported
+	}
+	return *o.serverSideApplySupported
+}
+
+// mergePrinterColumns merges the extra printer columns into the embedded
+// ones, deduplicating by column name with the extra column winning. The
+// embedded column order is preserved; new columns are appended.
+func mergePrinterColumns(embedded, extra []apiextensionsv1beta1.CustomResourceColumnDefinition) []apiextensionsv1beta1.CustomResourceColumnDefinition {
+	if len(extra) == 0 {
+		return embedded
+	}
+
+	merged := make([]apiextensionsv1beta1.CustomResourceColumnDefinition, 0, len(embedded)+len(extra))
+	overridden := make(map[string]apiextensionsv1beta1.CustomResourceColumnDefinition, len(extra))
+	for _, col := range extra {
+		overridden[col.Name] = col
+	}
+
+	for _, col := range embedded {
+		if override, ok := overridden[col.Name]; ok {
+			col = override
+			delete(overridden, col.Name)
+		}
+		merged = append(merged, col)
+	}
+
+	for _, col := range extra {
+		if _, ok := overridden[col.Name]; ok {
+			merged = append(merged, col)
+		}
+	}
+
+	return merged
+}
+
+// CRDConversion describes the conversion webhook attached to the installed
+// CRDs.
+type CRDConversion struct {
+	// WebhookClientConfig tells the apiserver how to reach the conversion
+	// webhook: either a URL or a service reference, with the CA bundle to
+	// verify its serving certificate.
+	WebhookClientConfig apiextensionsv1beta1.WebhookClientConfig
+
+	// ConversionReviewVersions lists the ConversionReview versions the
+	// webhook understands, in order of preference. Defaults to v1beta1
+	// when empty.
+	ConversionReviewVersions []string
+}
+
+// validate checks the webhook client config is routable.
+func (c *CRDConversion) validate() error {
+	if c.WebhookClientConfig.URL == nil && c.WebhookClientConfig.Service == nil {
+		return fmt.Errorf("CRD conversion webhook requires a URL or a service reference")
+	}
+	return nil
+}
+
+// conversion returns the CRD conversion stanza for the configuration, an
+// explicit None strategy for a nil receiver.
+func (c *CRDConversion) conversion() *apiextensionsv1beta1.CustomResourceConversion {
+	if c == nil {
+		return &apiextensionsv1beta1.CustomResourceConversion{
+			Strategy: apiextensionsv1beta1.NoneConverter,
+		}
+	}
+
+	webhookConfig := c.WebhookClientConfig
+	reviewVersions := c.ConversionReviewVersions
+	if len(reviewVersions) == 0 {
+		reviewVersions = []string{"v1beta1"}
+	}
+
+	return &apiextensionsv1beta1.CustomResourceConversion{
+		Strategy:                 apiextensionsv1beta1.WebhookConverter,
+		WebhookClientConfig:      &webhookConfig,
+		ConversionReviewVersions: reviewVersions,
+	}
+}
+
+// CRDOwner identifies the cluster-scoped object which owns the installed
+// CRDs, e.g. the operator Deployment's cluster-scoped parent or a dedicated
+// marker object.
+type CRDOwner struct {
+	// APIVersion and Kind identify the owner's type.
+	APIVersion string
+	Kind       string
+
+	// Name and UID identify the owning object.
+	Name string
+	UID  k8stypes.UID
+
+	// Namespace must be empty: cluster-scoped CRDs can only be owned by
+	// cluster-scoped objects. The field exists so that callers passing a
+	// namespaced object get a clear validation error instead of a CRD
+	// which the garbage collector deletes immediately.
+	Namespace string
+}
+
+// validate checks the owner is complete and cluster-scoped.
+func (o *CRDOwner) validate() error {
+	if o.Namespace != "" {
+		return fmt.Errorf("CRD owner %s %q is namespaced: cluster-scoped CRDs can only be owned by cluster-scoped objects",
+			o.Kind, o.Name)
+	}
+	if o.APIVersion == "" || o.Kind == "" || o.Name == "" || o.UID == "" {
+		return fmt.Errorf("CRD owner requires apiVersion, kind, name and uid")
+	}
+	return nil
+}
+
+// reference returns the owner as a metav1.OwnerReference.
+func (o *CRDOwner) reference() metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: o.APIVersion,
+		Kind:       o.Kind,
+		Name:       o.Name,
+		UID:        o.UID,
+	}
+}
+
+// CRDReport is the structured result of ReconcileCRDs, keyed by the
+// metadata.name of each reconciled CRD.
+type CRDReport struct {
+	// Actions maps each CRD to the reconcile action taken: "create",
+	// "update", "none", "skip" or "paused". Under DryRun it is the action
+	// which would have been taken.
+	Actions map[string]string
+
+	// Errors maps each CRD whose reconciliation failed to its error.
+	Errors map[string]error
+
+	// Versions maps each CRD to the schema version it carries after
+	// reconciliation.
+	Versions map[string]string
+}
+
+// CRDInstallResult describes the outcome of installing a single CRD.
+type CRDInstallResult struct {
+	// Name is the metadata.name of the CRD.
+	Name string
+
+	// Action is the reconcile action taken: "create", "update", "none",
+	// "skip" or "paused".
+	Action string
+
+	// SchemaVersion is the schema version the CRD carries after the
+	// installation.
+	SchemaVersion string
+
+	// Error is the per-CRD failure, if any.
+	Error error
+}
+
+// InstallResults flattens the report into a per-CRD result slice, sorted by
+// CRD name for deterministic logging.
+func (r CRDReport) InstallResults() []CRDInstallResult {
+	results := make([]CRDInstallResult, 0, len(r.Actions))
+	for name, action := range r.Actions {
+		results = append(results, CRDInstallResult{
+			Name:          name,
+			Action:        action,
+			SchemaVersion: r.Versions[name],
+			Error:         r.Errors[name],
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+
+	return results
+}
+
+// ListCiliumCRDNames returns the canonical set of CRD names (CNPCRDName et
+// al.) this package manages under the given identity allocation mode. The
+// identity CRD is only included when identities are allocated through CRDs.
+// Create, delete and preflight call sites should derive their CRD lists from
+// this function so they cannot drift apart.
+func ListCiliumCRDNames(identityAllocationMode string) []string {
+	names := []string{CNPCRDName, CCNPCRDName, CEPCRDName, CNCRDName}
+	if identityAllocationMode == option.IdentityAllocationModeCRD {
+		names = append(names, CIDCRDName)
+	}
+	return names
+}
+
+// managedCRDs returns the construct function for every CRD managed by this
+// agent. The name set derives from ListCiliumCRDNames under the runtime
+// identity allocation mode, with the configured identity CRD mode applied on
+// top.
+func managedCRDs() map[string]func() (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	crds := map[string]func() (*apiextensionsv1beta1.CustomResourceDefinition, error){}
+	for _, crdName := range ListCiliumCRDNames(option.Config.IdentityAllocationMode) {
+		crds[crdName] = crdConstructFor(crdName)
+	}
+
+	switch identityCRDMode {
+	case IdentityCRDAlways:
+		crds[CIDCRDName] = crdConstructFor(CIDCRDName)
+	case IdentityCRDNever:
+		delete(crds, CIDCRDName)
+	}
+
+	return crds
+}
+
+// ReconcileCRDs reconciles the managed CRDs against the cluster according to
+// the given options and returns a structured report of the per-CRD actions.
+// The CRDs are reconciled concurrently; the returned error is the first
+// failure, with the per-CRD errors available in the report.
+func ReconcileCRDs(ctx context.Context, clientset apiextensionsclient.Interface,
+	opts ReconcileOptions) (CRDReport, error) {
+
+	report := CRDReport{
+		Actions:  map[string]string{},
+		Errors:   map[string]error{},
+		Versions: map[string]string{},
+	}
+
+	if err := waitForAPIServerReady(clientset); err != nil {
+		return report, err
+	}
+
+	if strictAssetCheck {
+		if err := ValidatePregeneratedCRDs(); err != nil {
+			return report, err
+		}
+	}
+
+	if opts.Owner != nil {
+		if err := opts.Owner.validate(); err != nil {
+			return report, err
+		}
+	}
+
+	if opts.Conversion != nil {
+		if err := opts.Conversion.validate(); err != nil {
+			return report, err
+		}
+	}
+
+	if _, ok := opts.ExtraLabels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey]; ok {
+		return report, fmt.Errorf("extra CRD label %s collides with the reserved schema version label",
+			k8sconstv2.CustomResourceDefinitionSchemaVersionKey)
+	}
+
+	if opts.ServerSideApply && opts.serverSideApplySupported == nil {
+		// Resolve the capability once up front; the goroutines below
+		// share the copied options and must not probe it per CRD.
+		supported := k8sversion.Capabilities().ServerSideApply
+		opts.serverSideApplySupported = &supported
+	}
+
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = 4
+	}
+	semaphore := make(chan struct{}, parallelism)
+
+	var mutex lock.Mutex
+	g, ctx := errgroup.WithContext(ctx)
+	for crdName, construct := range managedCRDs() {
+		if len(opts.Filter) > 0 && !sliceContains(opts.Filter, crdName) {
+			continue
+		}
+
+		crdName, construct := crdName, construct
+		g.Go(func() error {
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-semaphore }()
+
+			crd, err := construct()
+			if err != nil {
+				mutex.Lock()
+				report.Errors[crdName] = err
+				mutex.Unlock()
+				return err
+			}
+
+			if opts.Owner != nil {
+				crd.OwnerReferences = []metav1.OwnerReference{opts.Owner.reference()}
+			}
+
+			crd.Spec.Conversion = opts.Conversion.conversion()
+
+			crd.Spec.AdditionalPrinterColumns = mergePrinterColumns(
+				crd.Spec.AdditionalPrinterColumns, opts.ExtraPrinterColumns)
+
+			for k, v := range opts.ExtraLabels {
+				crd.Labels[k] = v
+			}
+			if len(opts.ExtraAnnotations) > 0 {
+				if crd.Annotations == nil {
+					crd.Annotations = map[string]string{}
+				}
+				for k, v := range opts.ExtraAnnotations {
+					crd.Annotations[k] = v
+				}
+			}
+
+			record, err := reconcileCRD(ctx, clientset, crdName, crd, opts)
+
+			mutex.Lock()
+			report.Actions[record.Name] = record.Action
+			report.Versions[record.Name] = record.finalVersion()
+			if err != nil {
+				report.Errors[record.Name] = err
+			}
+			mutex.Unlock()
+
+			return err
+		})
+	}
+
+	return report, g.Wait()
+}
@@ -0,0 +1,610 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"context"
+	"time"
+
+	ciliumv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	ciliumfake "github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/fake"
+	"github.com/cilium/cilium/pkg/lock"
+	"github.com/cilium/cilium/pkg/option"
+	. "gopkg.in/check.v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsDryRun(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	// The fake clientset does not implement server-side dry-run and would
+	// persist the dry-run creates; emulate the apiserver by answering them
+	// without storing the object.
+	clientset.PrependReactor("create", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, action.(k8stesting.CreateAction).GetObject(), nil
+		})
+
+	// A dry run against an empty cluster reports "create" for every
+	// managed CRD without creating anything.
+	report, err := ReconcileCRDs(context.Background(), clientset, ReconcileOptions{DryRun: true})
+	c.Assert(err, IsNil)
+	c.Assert(report.Actions, HasLen, 4)
+	for _, action := range report.Actions {
+		c.Assert(action, Equals, "create")
+	}
+
+	crds, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().List(
+		context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(crds.Items, HasLen, 0)
+}
+
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsFilter(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	report, err := ReconcileCRDs(context.Background(), clientset, ReconcileOptions{
+		Filter: []string{CNPCRDName},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(report.Actions, HasLen, 1)
+	c.Assert(report.Actions[ciliumv2.CNPName], Equals, "create")
+	c.Assert(report.Errors, HasLen, 0)
+
+	crds, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().List(
+		context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(crds.Items, HasLen, 1)
+}
+
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsCreateOnly(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+
+	clusterCRD := crd.DeepCopy()
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+	clusterCRD.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{
+			Type:   apiextensionsv1beta1.Established,
+			Status: apiextensionsv1beta1.ConditionTrue,
+		},
+	}
+
+	clientset := s.newEstablishingClientset()
+	_, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Create(
+		context.TODO(), clusterCRD, metav1.CreateOptions{})
+	c.Assert(err, IsNil)
+
+	// Create-only reconciliation must leave the outdated CRD untouched.
+	report, err := ReconcileCRDs(context.Background(), clientset, ReconcileOptions{
+		Filter:     []string{CNPCRDName},
+		CreateOnly: true,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(report.Actions[ciliumv2.CNPName], Equals, "none")
+
+	current, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(current.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey], Equals, "0.9")
+}
+
+func (s *CiliumV2RegisterSuite) TestCreateCustomResourceDefinitionsFor(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	// An unknown name is rejected before anything reaches the cluster.
+	err := CreateCustomResourceDefinitionsFor(context.Background(), clientset, CNPCRDName, "bogus")
+	c.Assert(err, ErrorMatches, `unknown CRD name "bogus"`)
+
+	crds, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().List(
+		context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(crds.Items, HasLen, 0)
+
+	// A valid subset installs only the requested CRDs.
+	err = CreateCustomResourceDefinitionsFor(context.Background(), clientset, CNPCRDName, CEPCRDName)
+	c.Assert(err, IsNil)
+
+	crds, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().List(
+		context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(crds.Items, HasLen, 2)
+}
+
+func (s *CiliumV2RegisterSuite) TestCreateCustomResourceDefinitionsWithResult(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	results, err := CreateCustomResourceDefinitionsWithResult(context.Background(), clientset)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 4)
+	for _, result := range results {
+		c.Assert(result.Action, Equals, "create")
+		c.Assert(result.SchemaVersion, Equals, ciliumv2.CustomResourceDefinitionSchemaVersion)
+		c.Assert(result.Error, IsNil)
+	}
+
+	// A second run finds everything current.
+	results, err = CreateCustomResourceDefinitionsWithResult(context.Background(), clientset)
+	c.Assert(err, IsNil)
+	for _, result := range results {
+		c.Assert(result.Action, Equals, "none")
+		c.Assert(result.SchemaVersion, Equals, ciliumv2.CustomResourceDefinitionSchemaVersion)
+	}
+}
+
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsOwnerReference(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	// A namespaced owner is rejected before anything reaches the cluster.
+	_, err := ReconcileCRDs(context.Background(), clientset, ReconcileOptions{
+		Owner: &CRDOwner{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       "cilium-operator",
+			Namespace:  "kube-system",
+			UID:        "1234",
+		},
+	})
+	c.Assert(err, ErrorMatches, ".*cluster-scoped CRDs can only be owned by cluster-scoped objects")
+
+	crds, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().List(
+		context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(crds.Items, HasLen, 0)
+
+	// A cluster-scoped owner ends up on every installed CRD.
+	_, err = ReconcileCRDs(context.Background(), clientset, ReconcileOptions{
+		Owner: &CRDOwner{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+			Name:       "kube-system",
+			UID:        "1234",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	crds, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().List(
+		context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(len(crds.Items) >= 4, Equals, true)
+	for _, crd := range crds.Items {
+		c.Assert(crd.OwnerReferences, HasLen, 1)
+		c.Assert(crd.OwnerReferences[0].Kind, Equals, "Namespace")
+	}
+}
+
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsExtraLabelsAnnotations(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	// Colliding with the reserved schema version label is rejected.
+	_, err := ReconcileCRDs(context.Background(), clientset, ReconcileOptions{
+		ExtraLabels: map[string]string{
+			ciliumv2.CustomResourceDefinitionSchemaVersionKey: "0.1",
+		},
+	})
+	c.Assert(err, ErrorMatches, ".*collides with the reserved schema version label")
+
+	_, err = ReconcileCRDs(context.Background(), clientset, ReconcileOptions{
+		ExtraLabels:      map[string]string{"app.kubernetes.io/managed-by": "cilium"},
+		ExtraAnnotations: map[string]string{"fleet.example.com/inventory": "networking"},
+	})
+	c.Assert(err, IsNil)
+
+	crds, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().List(
+		context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(len(crds.Items) >= 4, Equals, true)
+	for _, crd := range crds.Items {
+		c.Assert(crd.Labels["app.kubernetes.io/managed-by"], Equals, "cilium")
+		c.Assert(crd.Annotations["fleet.example.com/inventory"], Equals, "networking")
+		// The reserved label is still owned by the installer.
+		c.Assert(crd.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey],
+			Equals, ciliumv2.CustomResourceDefinitionSchemaVersion)
+	}
+}
+
+func (s *CiliumV2RegisterSuite) TestCRDPollConfigBackoff(c *C) {
+	cfg := &CRDPollConfig{
+		Interval:      time.Millisecond,
+		BackoffFactor: 2,
+		MaxInterval:   5 * time.Millisecond,
+	}
+
+	// The condition runs immediately and on every backed-off attempt.
+	attempts := 0
+	err := cfg.poll(context.Background(), func() (bool, error) {
+		attempts++
+		return attempts >= 3, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(attempts, Equals, 3)
+
+	// Cancelling the context terminates the wait like a deadline would.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = cfg.poll(ctx, func() (bool, error) { return false, nil })
+	c.Assert(err, Equals, wait.ErrWaitTimeout)
+}
+
+// TestCRDExists covers the read-only installation status check.
+func (s *CiliumV2RegisterSuite) TestCRDExists(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	installed, upToDate, err := CRDExists(context.TODO(), clientset, CNPCRDName)
+	c.Assert(err, IsNil)
+	c.Assert(installed, Equals, false)
+	c.Assert(upToDate, Equals, false)
+
+	_, err = ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{Filter: []string{CNPCRDName}})
+	c.Assert(err, IsNil)
+
+	installed, upToDate, err = CRDExists(context.TODO(), clientset, CNPCRDName)
+	c.Assert(err, IsNil)
+	c.Assert(installed, Equals, true)
+	c.Assert(upToDate, Equals, true)
+
+	// An outdated schema version label reports the CRD as installed but
+	// stale; the check itself must not repair it.
+	crd := s.mustConstructCNPCRD(c)
+	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+	_, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Update(
+		context.TODO(), clusterCRD, metav1.UpdateOptions{})
+	c.Assert(err, IsNil)
+
+	installed, upToDate, err = CRDExists(context.TODO(), clientset, CNPCRDName)
+	c.Assert(err, IsNil)
+	c.Assert(installed, Equals, true)
+	c.Assert(upToDate, Equals, false)
+
+	_, _, err = CRDExists(context.TODO(), clientset, "no-such-crd")
+	c.Assert(err, ErrorMatches, `unknown CRD name "no-such-crd"`)
+}
+
+// TestReconcileCRDsConversion covers the conversion strategy attached to
+// installed CRDs.
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsConversion(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	// Without a conversion config the None strategy is set explicitly.
+	_, err := ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{Filter: []string{CNPCRDName}})
+	c.Assert(err, IsNil)
+
+	crd := s.mustConstructCNPCRD(c)
+	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(clusterCRD.Spec.Conversion, NotNil)
+	c.Assert(clusterCRD.Spec.Conversion.Strategy, Equals, apiextensionsv1beta1.NoneConverter)
+
+	// A webhook conversion config is carried onto the CRD, with the review
+	// versions defaulted.
+	path := "/convert"
+	conversion := &CRDConversion{
+		WebhookClientConfig: apiextensionsv1beta1.WebhookClientConfig{
+			CABundle: []byte("ca-bundle"),
+			Service: &apiextensionsv1beta1.ServiceReference{
+				Namespace: "kube-system",
+				Name:      "cilium-conversion-webhook",
+				Path:      &path,
+			},
+		},
+	}
+	_, err = ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{
+		Filter:     []string{CEPCRDName},
+		Conversion: conversion,
+	})
+	c.Assert(err, IsNil)
+
+	cepCRD, err := constructCEPCRD()
+	c.Assert(err, IsNil)
+	clusterCRD, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), cepCRD.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(clusterCRD.Spec.Conversion.Strategy, Equals, apiextensionsv1beta1.WebhookConverter)
+	c.Assert(clusterCRD.Spec.Conversion.WebhookClientConfig.Service.Name, Equals, "cilium-conversion-webhook")
+	c.Assert(clusterCRD.Spec.Conversion.ConversionReviewVersions, DeepEquals, []string{"v1beta1"})
+
+	// A webhook without URL or service reference is rejected before
+	// anything is mutated.
+	_, err = ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{
+		Conversion: &CRDConversion{},
+	})
+	c.Assert(err, ErrorMatches, "CRD conversion webhook requires a URL or a service reference")
+}
+
+// TestReconcileCRDsExtraPrinterColumns covers merging extra printer columns
+// into the embedded ones at install time.
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsExtraPrinterColumns(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	crd := s.mustConstructCNPCRD(c)
+	embedded := crd.Spec.AdditionalPrinterColumns
+	c.Assert(len(embedded) > 0, Equals, true)
+
+	extra := []apiextensionsv1beta1.CustomResourceColumnDefinition{
+		{Name: "Flavor", Type: "string", JSONPath: ".metadata.annotations.flavor"},
+		// Overrides the embedded column of the same name.
+		{Name: embedded[0].Name, Type: "string", JSONPath: ".metadata.uid"},
+	}
+	_, err := ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{
+		Filter:              []string{CNPCRDName},
+		ExtraPrinterColumns: extra,
+	})
+	c.Assert(err, IsNil)
+
+	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+
+	// The embedded columns survive, with the override applied in place and
+	// the new column appended.
+	columns := clusterCRD.Spec.AdditionalPrinterColumns
+	c.Assert(columns, HasLen, len(embedded)+1)
+	c.Assert(columns[0].Name, Equals, embedded[0].Name)
+	c.Assert(columns[0].JSONPath, Equals, ".metadata.uid")
+	c.Assert(columns[len(columns)-1].Name, Equals, "Flavor")
+
+	// Without the option the embedded columns are installed verbatim.
+	cepClientset := s.newEstablishingClientset()
+	_, err = ReconcileCRDs(context.TODO(), cepClientset, ReconcileOptions{Filter: []string{CNPCRDName}})
+	c.Assert(err, IsNil)
+	clusterCRD, err = cepClientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(clusterCRD.Spec.AdditionalPrinterColumns, DeepEquals, embedded)
+}
+
+// TestReconcileCRDsDeleteOnFailure covers the cleanup behavior when the
+// establishment wait times out.
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsDeleteOnFailure(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+	poll := &CRDPollConfig{Interval: 10 * time.Millisecond, Timeout: 100 * time.Millisecond}
+
+	// By default the never-establishing CRD survives the timeout.
+	clientset := fake.NewSimpleClientset()
+	_, err := ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{
+		Filter: []string{CNPCRDName},
+		Poll:   poll,
+	})
+	c.Assert(err, NotNil)
+
+	_, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+
+	// With DeleteOnFailure the newly created CRD is removed for a clean
+	// retry.
+	clientset = fake.NewSimpleClientset()
+	_, err = ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{
+		Filter:          []string{CNPCRDName},
+		Poll:            poll,
+		DeleteOnFailure: true,
+	})
+	c.Assert(err, NotNil)
+
+	_, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(errors.IsNotFound(err), Equals, true)
+}
+
+// TestReconcileCRDsParallelism covers the concurrency bound on CRD
+// reconciliation.
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsParallelism(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	// Track how many create calls are in flight simultaneously.
+	var (
+		mutex         lock.Mutex
+		inFlight, max int
+	)
+	clientset.PrependReactor("create", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			mutex.Lock()
+			inFlight++
+			if inFlight > max {
+				max = inFlight
+			}
+			mutex.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mutex.Lock()
+			inFlight--
+			mutex.Unlock()
+			return false, nil, nil
+		})
+
+	_, err := ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{Parallelism: 1})
+	c.Assert(err, IsNil)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	c.Assert(max, Equals, 1)
+}
+
+// TestReconcileCRDsInstalledVersion covers the schema version reported after
+// reconciliation.
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsInstalledVersion(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	report, err := ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{Filter: []string{CNPCRDName}})
+	c.Assert(err, IsNil)
+
+	crd := s.mustConstructCNPCRD(c)
+	c.Assert(report.Versions[crd.ObjectMeta.Name], Equals,
+		crd.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey])
+
+	// A newer CRD left untouched is reported with its own, newer version.
+	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "99.0"
+	_, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Update(
+		context.TODO(), clusterCRD, metav1.UpdateOptions{})
+	c.Assert(err, IsNil)
+
+	report, err = ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{Filter: []string{CNPCRDName}})
+	c.Assert(err, IsNil)
+	c.Assert(report.Actions[crd.ObjectMeta.Name], Equals, "none")
+	c.Assert(report.Versions[crd.ObjectMeta.Name], Equals, "99.0")
+}
+
+// TestListCiliumCRDNames covers the canonical CRD name set per identity
+// allocation mode.
+func (s *CiliumV2RegisterSuite) TestListCiliumCRDNames(c *C) {
+	names := ListCiliumCRDNames(option.IdentityAllocationModeCRD)
+	c.Assert(names, DeepEquals, []string{CNPCRDName, CCNPCRDName, CEPCRDName, CNCRDName, CIDCRDName})
+
+	names = ListCiliumCRDNames(option.IdentityAllocationModeKVstore)
+	c.Assert(names, DeepEquals, []string{CNPCRDName, CCNPCRDName, CEPCRDName, CNCRDName})
+}
+
+// TestReconcileCRDsMaxStartupDelay covers the jittered pre-create delay and
+// its cancellation.
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsMaxStartupDelay(c *C) {
+	clientset := s.newEstablishingClientset()
+
+	// A small delay stays transparent to a successful reconcile.
+	_, err := ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{
+		Filter:          []string{CNPCRDName},
+		MaxStartupDelay: 10 * time.Millisecond,
+	})
+	c.Assert(err, IsNil)
+
+	// Cancelling the context aborts the delay instead of sleeping it out.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	started := time.Now()
+	_, err = ReconcileCRDs(ctx, s.newEstablishingClientset(), ReconcileOptions{
+		Filter:          []string{CNPCRDName},
+		MaxStartupDelay: time.Hour,
+	})
+	c.Assert(err, NotNil)
+	c.Assert(time.Since(started) < time.Second, Equals, true)
+}
+
+// TestCreateCustomResourceDefinitionsAsLeader covers the leader-election
+// gating of CRD installation.
+func (s *CiliumV2RegisterSuite) TestCreateCustomResourceDefinitionsAsLeader(c *C) {
+	// The leader installs the CRDs.
+	clientset := s.newEstablishingClientset()
+	err := CreateCustomResourceDefinitionsAsLeader(context.TODO(), clientset, func() bool { return true })
+	c.Assert(err, IsNil)
+
+	list, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().List(
+		context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(len(list.Items) > 0, Equals, true)
+
+	// A non-leader only observes: with the CRDs already established it
+	// returns without issuing a single write.
+	seeded := make([]runtime.Object, 0)
+	for _, construct := range managedCRDs() {
+		crd, err := construct()
+		c.Assert(err, IsNil)
+		crd.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+			{
+				Type:   apiextensionsv1beta1.Established,
+				Status: apiextensionsv1beta1.ConditionTrue,
+			},
+		}
+		seeded = append(seeded, crd)
+	}
+	follower := fake.NewSimpleClientset(seeded...)
+
+	err = CreateCustomResourceDefinitionsAsLeader(context.TODO(), follower, func() bool { return false })
+	c.Assert(err, IsNil)
+
+	for _, action := range follower.Actions() {
+		c.Assert(action.GetVerb(), Equals, "get")
+	}
+}
+
+// TestReconcileCRDsNameConflict verifies a NamesAccepted failure surfaces the
+// condition message naming the conflicting resource.
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsNameConflict(c *C) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			crd := action.(k8stesting.CreateAction).GetObject().(*apiextensionsv1beta1.CustomResourceDefinition)
+			crd.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+				{
+					Type:    apiextensionsv1beta1.NamesAccepted,
+					Status:  apiextensionsv1beta1.ConditionFalse,
+					Reason:  "NotAccepted",
+					Message: `plural "ciliumnetworkpolicies" is already claimed by example.io`,
+				},
+			}
+			return false, nil, nil
+		})
+
+	_, err := ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{
+		Filter: []string{CNPCRDName},
+		Poll:   &CRDPollConfig{Interval: 10 * time.Millisecond, Timeout: time.Second},
+	})
+	c.Assert(err, ErrorMatches, `.*NotAccepted.*already claimed by example.io`)
+}
+
+// TestReconcileCRDsPartiallyCreated verifies a cluster CRD left without a
+// schema by a crashed agent converges to the full schema on the next
+// reconcile.
+func (s *CiliumV2RegisterSuite) TestReconcileCRDsPartiallyCreated(c *C) {
+	bare := s.mustConstructCNPCRD(c)
+	bare.Spec.Validation = nil
+	bare.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{
+			Type:   apiextensionsv1beta1.Established,
+			Status: apiextensionsv1beta1.ConditionTrue,
+		},
+	}
+	clientset := fake.NewSimpleClientset(bare)
+
+	report, err := ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{Filter: []string{CNPCRDName}})
+	c.Assert(err, IsNil)
+	c.Assert(report.Actions[bare.ObjectMeta.Name], Equals, "update")
+
+	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), bare.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(clusterCRD.Spec.Validation, NotNil)
+}
+
+// TestClientsetEnsureCRDs covers the bundled clientset wrapper.
+func (s *CiliumV2RegisterSuite) TestClientsetEnsureCRDs(c *C) {
+	apiextensionsClient := s.newEstablishingClientset()
+	ciliumClient := ciliumfake.NewSimpleClientset()
+
+	bundle := NewClientset(ciliumClient.CiliumV2(), apiextensionsClient)
+	c.Assert(bundle.EnsureCRDs(context.TODO()), IsNil)
+
+	list, err := apiextensionsClient.ApiextensionsV1beta1().CustomResourceDefinitions().List(
+		context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(len(list.Items) > 0, Equals, true)
+
+	// The embedded typed client is usable directly on the bundle.
+	_, err = bundle.CiliumNetworkPolicies("ns1").List(context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+}
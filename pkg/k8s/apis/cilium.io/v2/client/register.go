@@ -16,23 +16,35 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	goerrors "errors"
 	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	k8sconstv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
 	"github.com/cilium/cilium/pkg/logging"
 	"github.com/cilium/cilium/pkg/logging/logfields"
-	"github.com/cilium/cilium/pkg/option"
+	"github.com/cilium/cilium/pkg/metrics"
+	"github.com/cilium/cilium/pkg/spanstat"
 	"github.com/cilium/cilium/pkg/versioncheck"
 
-	"golang.org/x/sync/errgroup"
+	go_version "github.com/blang/semver"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"sigs.k8s.io/yaml"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
@@ -53,95 +65,375 @@ const (
 
 	// CNCRDName is the full name of the CN CRD.
 	CNCRDName = k8sconstv2.CNKindDefinition + "/" + k8sconstv2.CustomResourceDefinitionVersion
+
+	// CRDReconcilePausedAnnotation is an annotation that admins can set on a
+	// CRD to make the agent skip any mutation of that CRD while it is set to
+	// a true value, e.g. during cluster maintenance. Removing the annotation
+	// resumes normal reconciliation.
+	CRDReconcilePausedAnnotation = "cilium.io/crd-reconcile-paused"
 )
 
 var (
 	// log is the k8s package logger object.
 	log = logging.DefaultLogger.WithField(logfields.LogSubsys, subsysK8s)
 
+	// crdEstablishmentDuration is a histogram of how long each managed CRD
+	// took to reach the Established condition, labeled by CRD name. The
+	// buckets cover the 0-60s establishment poll budget so that rollout
+	// percentiles, e.g. during a mass agent restart, can be computed.
+	crdEstablishmentDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: metrics.SubsystemK8s,
+		Name:      "crd_establishment_duration_seconds",
+		Help:      "Duration in seconds until a managed CRD reached the Established condition",
+		Buckets:   []float64{.25, .5, 1, 2.5, 5, 10, 15, 30, 45, 60},
+	}, []string{"crd_name"})
+
 	comparableCRDSchemaVersion = versioncheck.MustVersion(k8sconstv2.CustomResourceDefinitionSchemaVersion)
+
+	// unlabeledCRDPolicy is the policy applied to existing CRDs which do
+	// not carry the Cilium schema version label. It defaults to taking
+	// over the CRD, which is the historical behavior.
+	unlabeledCRDPolicy = UnlabeledCRDTakeover
+)
+
+// UnlabeledCRDPolicy controls how an existing CRD that does not carry the
+// Cilium schema version label, i.e. a CRD installed by a third party, is
+// treated during installation.
+type UnlabeledCRDPolicy string
+
+const (
+	// UnlabeledCRDTakeover overwrites the unlabeled CRD with the
+	// pregenerated schema. This is the default behavior.
+	UnlabeledCRDTakeover UnlabeledCRDPolicy = "takeover"
+
+	// UnlabeledCRDSkip leaves the unlabeled CRD untouched.
+	UnlabeledCRDSkip UnlabeledCRDPolicy = "skip"
+
+	// UnlabeledCRDError fails the installation of the unlabeled CRD with
+	// an error.
+	UnlabeledCRDError UnlabeledCRDPolicy = "error"
+)
+
+// SetUnlabeledCRDPolicy sets the policy applied to existing CRDs which do not
+// carry the Cilium schema version label. Operators sharing a cluster with
+// third-party managed CRDs can use UnlabeledCRDSkip or UnlabeledCRDError to
+// avoid overwriting a schema Cilium does not own.
+func SetUnlabeledCRDPolicy(policy UnlabeledCRDPolicy) error {
+	switch policy {
+	case UnlabeledCRDTakeover, UnlabeledCRDSkip, UnlabeledCRDError:
+		unlabeledCRDPolicy = policy
+		return nil
+	default:
+		return fmt.Errorf("unknown unlabeled CRD policy %q", policy)
+	}
+}
+
+func init() {
+	metrics.MustRegister(crdEstablishmentDuration)
+}
+
+// IdentityCRDMode controls whether CreateCustomResourceDefinitions manages
+// the CiliumIdentity CRD.
+type IdentityCRDMode string
+
+const (
+	// IdentityCRDAuto installs the identity CRD only when the identity
+	// allocation mode is CRD-based. This is the default behavior.
+	IdentityCRDAuto IdentityCRDMode = "auto"
+
+	// IdentityCRDAlways installs the identity CRD regardless of the
+	// identity allocation mode, e.g. to prepare for a mode switch.
+	IdentityCRDAlways IdentityCRDMode = "always"
+
+	// IdentityCRDNever suppresses installation of the identity CRD.
+	IdentityCRDNever IdentityCRDMode = "never"
 )
 
+// identityCRDMode determines whether the identity CRD is managed independent
+// of the runtime identity allocation mode.
+var identityCRDMode = IdentityCRDAuto
+
+// SetIdentityCRDMode sets whether the CiliumIdentity CRD is managed
+// independent of the identity allocation mode.
+func SetIdentityCRDMode(mode IdentityCRDMode) error {
+	switch mode {
+	case IdentityCRDAuto, IdentityCRDAlways, IdentityCRDNever:
+		identityCRDMode = mode
+		return nil
+	default:
+		return fmt.Errorf("unknown identity CRD mode %q", mode)
+	}
+}
+
+// deepSchemaComparison controls whether needsUpdate additionally
+// deep-compares the validation schema of the cluster CRD against the
+// pregenerated one. The label-only comparison is cheaper and remains the
+// default for startup performance.
+var deepSchemaComparison bool
+
+// SetDeepSchemaComparison enables or disables the deep comparison of the
+// cluster CRD validation schema during the update check. With it enabled, a
+// manually edited schema is reconciled back even when the schema version
+// label still matches.
+func SetDeepSchemaComparison(enabled bool) {
+	deepSchemaComparison = enabled
+}
+
+// strictAssetCheck controls whether CreateCustomResourceDefinitions first
+// verifies that the embedded CRD assets match the compiled-in schema version.
+var strictAssetCheck bool
+
+// SetStrictAssetCheck enables or disables the startup self-check of the
+// pregenerated CRD assets performed by CreateCustomResourceDefinitions.
+func SetStrictAssetCheck(enabled bool) {
+	strictAssetCheck = enabled
+}
+
+// ValidatePregeneratedCRDs loads every pregenerated CRD asset and verifies it
+// is consistent with the compiled-in constants, i.e. the asset's name matches
+// the expected <plural>.<group> and, when the asset carries its own schema
+// version label, that it is a parsable version. This catches a build which
+// embeds stale or corrupted assets before it reaches a cluster.
+func ValidatePregeneratedCRDs() error {
+	pregenerated := map[string]string{
+		CNPCRDName:  k8sconstv2.CNPName,
+		CCNPCRDName: k8sconstv2.CCNPName,
+		CEPCRDName:  k8sconstv2.CEPName,
+		CIDCRDName:  k8sconstv2.CIDName,
+		CNCRDName:   k8sconstv2.CNName,
+	}
+
+	for crdName, expectedName := range pregenerated {
+		crd, err := GetPregeneratedCRD(crdName)
+		if err != nil {
+			return err
+		}
+
+		if crd.ObjectMeta.Name != expectedName {
+			return fmt.Errorf("pregenerated CRD asset %s is stale: asset name %q does not match compiled name %q",
+				crdName, crd.ObjectMeta.Name, expectedName)
+		}
+
+		if v, ok := crd.Labels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey]; ok {
+			if _, err := versioncheck.Version(v); err != nil {
+				return fmt.Errorf("pregenerated CRD asset %s carries unparsable schema version %q: %s",
+					crdName, v, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// SharedCRDInformer allows reusing an already running CRD informer so that
+// reads performed during CRD installation are served from the shared cache
+// instead of issuing additional apiserver calls.
+type SharedCRDInformer struct {
+	// Store is the informer's store containing v1beta1
+	// CustomResourceDefinition objects.
+	Store cache.Store
+
+	// HasSynced reports whether Store completed its initial sync. Reads
+	// fall back to direct apiserver calls until it returns true.
+	HasSynced func() bool
+}
+
+// sharedCRDInformer is the informer registered via UseSharedCRDInformer, if
+// any.
+var sharedCRDInformer *SharedCRDInformer
+
+// UseSharedCRDInformer registers a shared CRD informer to be used for reads
+// during CRD installation. Passing nil reverts to direct apiserver calls.
+func UseSharedCRDInformer(informer *SharedCRDInformer) {
+	sharedCRDInformer = informer
+}
+
+// getClusterCRD returns the named CRD from the shared informer cache when one
+// is registered and synced, and directly from the apiserver otherwise.
+func getClusterCRD(clientset apiextensionsclient.Interface, name string) (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	if informer := sharedCRDInformer; informer != nil && informer.HasSynced != nil && informer.HasSynced() {
+		obj, exists, err := informer.Store.GetByKey(name)
+		if err == nil {
+			if !exists {
+				return nil, errors.NewNotFound(apiextensionsv1beta1.Resource("customresourcedefinitions"), name)
+			}
+			if clusterCRD, ok := obj.(*apiextensionsv1beta1.CustomResourceDefinition); ok {
+				return clusterCRD.DeepCopy(), nil
+			}
+		}
+		// Fall through to a direct apiserver call on cache errors or
+		// unexpected object types.
+	}
+
+	return clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(),
+		name,
+		metav1.GetOptions{})
+}
+
 // CreateCustomResourceDefinitions creates our CRD objects in the Kubernetes
-// cluster.
-func CreateCustomResourceDefinitions(clientset apiextensionsclient.Interface) error {
-	g, _ := errgroup.WithContext(context.Background())
+// cluster. It delegates to ReconcileCRDs with default options. Cancelling ctx
+// aborts the installation, including in-flight establishment polls, so agent
+// shutdown does not block on the poll timeout.
+func CreateCustomResourceDefinitions(ctx context.Context, clientset apiextensionsclient.Interface) error {
+	_, err := CreateCustomResourceDefinitionsWithResult(ctx, clientset)
+	return err
+}
 
-	g.Go(func() error {
-		return createCNPCRD(clientset)
-	})
+// CreateCustomResourceDefinitionsWithResult installs the managed CRDs like
+// CreateCustomResourceDefinitions and additionally returns what was done per
+// CRD, so that callers can log a concise summary or assert on the exact
+// reconciliation actions without parsing log output.
+func CreateCustomResourceDefinitionsWithResult(ctx context.Context,
+	clientset apiextensionsclient.Interface) ([]CRDInstallResult, error) {
 
-	g.Go(func() error {
-		return createCCNPCRD(clientset)
-	})
+	report, err := ReconcileCRDs(ctx, clientset, ReconcileOptions{})
+	return report.InstallResults(), err
+}
 
-	g.Go(func() error {
-		return createCEPCRD(clientset)
-	})
+// CreateCustomResourceDefinitionsAsLeader installs the CRDs when this agent
+// is the leader and otherwise only blocks until the CRDs are established.
+// CRD installation is a singleton concern; with every agent of a large
+// cluster attempting it, the apiserver sees a flood of redundant write
+// traffic. Gating the install on leader election removes that load while
+// non-leaders still wait for the leader's install to take effect before
+// proceeding. A nil amLeader guard behaves like the leader path.
+func CreateCustomResourceDefinitionsAsLeader(ctx context.Context, clientset apiextensionsclient.Interface,
+	amLeader func() bool) error {
 
-	g.Go(func() error {
-		return createNodeCRD(clientset)
-	})
+	if amLeader == nil || amLeader() {
+		return CreateCustomResourceDefinitions(ctx, clientset)
+	}
 
-	if option.Config.IdentityAllocationMode == option.IdentityAllocationModeCRD {
-		g.Go(func() error {
-			return createIdentityCRD(clientset)
-		})
+	names := make([]string, 0, len(managedCRDs()))
+	for crdName, construct := range managedCRDs() {
+		crd, err := construct()
+		if err != nil {
+			return fmt.Errorf("unable to construct CRD %s: %w", crdName, err)
+		}
+		names = append(names, crd.ObjectMeta.Name)
 	}
 
-	return g.Wait()
+	return WaitForCRDsEstablished(ctx, clientset, names, (*CRDPollConfig)(nil).timeout())
 }
 
-// GetPregeneratedCRD returns the pregenerated CRD based on the requested CRD
-// name. The pregenerated CRDs are generated by the controller-gen tool and
-// serialized into binary form by go-bindata. This function retrieves CRDs from
-// the binary form.
-func GetPregeneratedCRD(crdName string) apiextensionsv1beta1.CustomResourceDefinition {
-	var (
-		err      error
-		crdBytes []byte
-	)
+// CreateCustomResourceDefinitionsFor installs only the CRDs with the given
+// names (CNPCRDName et al.). Unknown names produce an error before anything
+// is mutated in the cluster. Requesting CIDCRDName remains subject to the
+// identity CRD mode, i.e. the identity CRD is still skipped when identities
+// are not allocated through CRDs.
+func CreateCustomResourceDefinitionsFor(ctx context.Context, clientset apiextensionsclient.Interface,
+	names ...string) error {
+
+	known := []string{CNPCRDName, CCNPCRDName, CEPCRDName, CIDCRDName, CNCRDName}
+	for _, name := range names {
+		if !sliceContains(known, name) {
+			return fmt.Errorf("unknown CRD name %q", name)
+		}
+	}
 
-	scopedLog := log.WithField("crdName", crdName)
+	_, err := ReconcileCRDs(ctx, clientset, ReconcileOptions{Filter: names})
+	return err
+}
 
+// crdConstructFor returns the construct function for the given managed CRD
+// name (CNPCRDName et al.), or nil for an unknown name. It is the single
+// mapping from canonical CRD names to construct functions; call sites
+// enumerating CRDs combine it with ListCiliumCRDNames.
+func crdConstructFor(crdName string) func() (*apiextensionsv1beta1.CustomResourceDefinition, error) {
 	switch crdName {
 	case CNPCRDName:
-		crdBytes, err = examplesCrdsCiliumnetworkpoliciesYamlBytes()
+		return constructCNPCRD
 	case CCNPCRDName:
-		crdBytes, err = examplesCrdsCiliumclusterwidenetworkpoliciesYamlBytes()
+		return constructCCNPCRD
 	case CEPCRDName:
-		crdBytes, err = examplesCrdsCiliumendpointsYamlBytes()
+		return constructCEPCRD
 	case CIDCRDName:
-		crdBytes, err = examplesCrdsCiliumidentitiesYamlBytes()
+		return constructIdentityCRD
 	case CNCRDName:
-		crdBytes, err = examplesCrdsCiliumnodesYamlBytes()
+		return constructNodeCRD
 	default:
-		scopedLog.Fatal("Pregenerated CRD does not exist")
+		return nil
+	}
+}
+
+// CRDExists reports whether the CRD with the given name (CNPCRDName et al.)
+// is installed in the cluster, and whether its schema is at least as new as
+// this agent's compiled-in version. It only issues reads, so preflight checks
+// and readiness probes can call it without accidentally writing to the
+// cluster. An unknown CRD name is an error.
+func CRDExists(ctx context.Context, clientset apiextensionsclient.Interface,
+	crdName string) (installed bool, upToDate bool, err error) {
+
+	construct := crdConstructFor(crdName)
+	if construct == nil {
+		return false, false, fmt.Errorf("unknown CRD name %q", crdName)
 	}
 
+	crd, err := construct()
 	if err != nil {
-		scopedLog.WithError(err).Fatal("Error retrieving pregenerated CRD")
+		return false, false, err
 	}
 
-	ciliumCRD := apiextensionsv1beta1.CustomResourceDefinition{}
-	err = yaml.Unmarshal(crdBytes, &ciliumCRD)
+	clusterCRD, err := getClusterCRD(clientset, crd.ObjectMeta.Name)
+	switch {
+	case errors.IsNotFound(err):
+		return false, false, nil
+	case err != nil:
+		return false, false, err
+	}
+
+	return true, !needsUpdate(crd, clusterCRD), nil
+}
+
+// GetPregeneratedCRD returns the pregenerated CRD based on the requested CRD
+// name. The pregenerated CRDs are generated by the controller-gen tool and
+// serialized into binary form by go-bindata. By default they are retrieved
+// from the embedded binary form; SetCRDSource can substitute another source,
+// e.g. a directory of patched CRD files.
+func GetPregeneratedCRD(crdName string) (apiextensionsv1beta1.CustomResourceDefinition, error) {
+	ciliumCRD, err := activeCRDSource().CRD(crdName)
 	if err != nil {
-		scopedLog.WithError(err).Fatal("Error unmarshalling pregenerated CRD")
+		return ciliumCRD, err
 	}
 
-	return ciliumCRD
+	// The construct functions later force Spec.Group to the Cilium group
+	// while keeping the template's Names; a template from another group
+	// would thus produce a name/group combination the apiserver rejects
+	// opaquely. Catch the build misconfiguration here with a clear error.
+	if ciliumCRD.Spec.Group != k8sconstv2.CustomResourceDefinitionGroup {
+		return ciliumCRD, fmt.Errorf("pregenerated CRD %s belongs to group %q, expected %q",
+			crdName, ciliumCRD.Spec.Group, k8sconstv2.CustomResourceDefinitionGroup)
+	}
+
+	return ciliumCRD, nil
 }
 
-// createCNPCRD creates and updates the CiliumNetworkPolicies CRD. It should be called
-// on agent startup but is idempotent and safe to call again.
-func createCNPCRD(clientset apiextensionsclient.Interface) error {
-	ciliumCRD := GetPregeneratedCRD(CNPCRDName)
+// pregeneratedSchemaVersion returns the schema version for the given
+// pregenerated asset, preferring a version carried on the asset itself over
+// the global compiled-in version. This allows bumping the schema version of
+// one CRD without making every other CRD appear outdated.
+func pregeneratedSchemaVersion(ciliumCRD apiextensionsv1beta1.CustomResourceDefinition) string {
+	if v := ciliumCRD.Labels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey]; v != "" {
+		return v
+	}
+	return k8sconstv2.CustomResourceDefinitionSchemaVersion
+}
+
+// constructCNPCRD builds the CiliumNetworkPolicies CRD as it is installed into the
+// cluster, normalized from the pregenerated assets.
+func constructCNPCRD() (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	ciliumCRD, err := GetPregeneratedCRD(CNPCRDName)
+	if err != nil {
+		return nil, err
+	}
 
 	res := &apiextensionsv1beta1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: k8sconstv2.CNPName,
 			Labels: map[string]string{
-				k8sconstv2.CustomResourceDefinitionSchemaVersionKey: k8sconstv2.CustomResourceDefinitionSchemaVersion,
+				k8sconstv2.CustomResourceDefinitionSchemaVersionKey: pregeneratedSchemaVersion(ciliumCRD),
 			},
 		},
 		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
@@ -157,22 +449,28 @@ func createCNPCRD(clientset apiextensionsclient.Interface) error {
 			Subresources:             ciliumCRD.Spec.Subresources,
 			Scope:                    ciliumCRD.Spec.Scope,
 			Validation:               ciliumCRD.Spec.Validation,
+			PreserveUnknownFields:    ciliumCRD.Spec.PreserveUnknownFields,
 		},
 	}
 
-	return createUpdateCRD(clientset, CNPCRDName, res)
+	applyGroupOverride(res)
+
+	return res, nil
 }
 
-// createCCNPCRD creates and updates the CiliumClusterwideNetworkPolicy CRD. It
-// should be called on agent startup but is idempotent and safe to call again.
-func createCCNPCRD(clientset apiextensionsclient.Interface) error {
-	ciliumCRD := GetPregeneratedCRD(CCNPCRDName)
+// constructCCNPCRD builds the CiliumClusterwideNetworkPolicy CRD as it is installed into the
+// cluster, normalized from the pregenerated assets.
+func constructCCNPCRD() (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	ciliumCRD, err := GetPregeneratedCRD(CCNPCRDName)
+	if err != nil {
+		return nil, err
+	}
 
 	res := &apiextensionsv1beta1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: k8sconstv2.CCNPName,
 			Labels: map[string]string{
-				k8sconstv2.CustomResourceDefinitionSchemaVersionKey: k8sconstv2.CustomResourceDefinitionSchemaVersion,
+				k8sconstv2.CustomResourceDefinitionSchemaVersionKey: pregeneratedSchemaVersion(ciliumCRD),
 			},
 		},
 		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
@@ -184,25 +482,33 @@ func createCCNPCRD(clientset apiextensionsclient.Interface) error {
 				ShortNames: ciliumCRD.Spec.Names.ShortNames,
 				Singular:   ciliumCRD.Spec.Names.Singular,
 			},
-			Subresources: ciliumCRD.Spec.Subresources,
-			Scope:        ciliumCRD.Spec.Scope,
-			Validation:   ciliumCRD.Spec.Validation,
+			AdditionalPrinterColumns: ciliumCRD.Spec.AdditionalPrinterColumns,
+			Subresources:             ciliumCRD.Spec.Subresources,
+			Scope:                    ciliumCRD.Spec.Scope,
+			Validation:               ciliumCRD.Spec.Validation,
+
+			PreserveUnknownFields: ciliumCRD.Spec.PreserveUnknownFields,
 		},
 	}
 
-	return createUpdateCRD(clientset, CCNPCRDName, res)
+	applyGroupOverride(res)
+
+	return res, nil
 }
 
-// createCEPCRD creates and updates the CiliumEndpoint CRD. It should be called
-// on agent startup but is idempotent and safe to call again.
-func createCEPCRD(clientset apiextensionsclient.Interface) error {
-	ciliumCRD := GetPregeneratedCRD(CEPCRDName)
+// constructCEPCRD builds the CiliumEndpoint CRD as it is installed into the
+// cluster, normalized from the pregenerated assets.
+func constructCEPCRD() (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	ciliumCRD, err := GetPregeneratedCRD(CEPCRDName)
+	if err != nil {
+		return nil, err
+	}
 
 	res := &apiextensionsv1beta1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: k8sconstv2.CEPName,
 			Labels: map[string]string{
-				k8sconstv2.CustomResourceDefinitionSchemaVersionKey: k8sconstv2.CustomResourceDefinitionSchemaVersion,
+				k8sconstv2.CustomResourceDefinitionSchemaVersionKey: pregeneratedSchemaVersion(ciliumCRD),
 			},
 		},
 		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
@@ -218,22 +524,28 @@ func createCEPCRD(clientset apiextensionsclient.Interface) error {
 			Subresources:             ciliumCRD.Spec.Subresources,
 			Scope:                    ciliumCRD.Spec.Scope,
 			Validation:               ciliumCRD.Spec.Validation,
+			PreserveUnknownFields:    ciliumCRD.Spec.PreserveUnknownFields,
 		},
 	}
 
-	return createUpdateCRD(clientset, CEPCRDName, res)
+	applyGroupOverride(res)
+
+	return res, nil
 }
 
-// createNodeCRD creates and updates the CiliumNode CRD. It should be called on
-// agent startup but is idempotent and safe to call again.
-func createNodeCRD(clientset apiextensionsclient.Interface) error {
-	ciliumCRD := GetPregeneratedCRD(CNCRDName)
+// constructNodeCRD builds the CiliumNode CRD as it is installed into the
+// cluster, normalized from the pregenerated assets.
+func constructNodeCRD() (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	ciliumCRD, err := GetPregeneratedCRD(CNCRDName)
+	if err != nil {
+		return nil, err
+	}
 
 	res := &apiextensionsv1beta1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: k8sconstv2.CNName,
 			Labels: map[string]string{
-				k8sconstv2.CustomResourceDefinitionSchemaVersionKey: k8sconstv2.CustomResourceDefinitionSchemaVersion,
+				k8sconstv2.CustomResourceDefinitionSchemaVersionKey: pregeneratedSchemaVersion(ciliumCRD),
 			},
 		},
 		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
@@ -245,25 +557,33 @@ func createNodeCRD(clientset apiextensionsclient.Interface) error {
 				ShortNames: ciliumCRD.Spec.Names.ShortNames,
 				Kind:       ciliumCRD.Spec.Names.Kind,
 			},
-			Subresources: ciliumCRD.Spec.Subresources,
-			Scope:        ciliumCRD.Spec.Scope,
-			Validation:   ciliumCRD.Spec.Validation,
+			AdditionalPrinterColumns: ciliumCRD.Spec.AdditionalPrinterColumns,
+			Subresources:             ciliumCRD.Spec.Subresources,
+			Scope:                    ciliumCRD.Spec.Scope,
+			Validation:               ciliumCRD.Spec.Validation,
+
+			PreserveUnknownFields: ciliumCRD.Spec.PreserveUnknownFields,
 		},
 	}
 
-	return createUpdateCRD(clientset, CNCRDName, res)
+	applyGroupOverride(res)
+
+	return res, nil
 }
 
-// createIdentityCRD creates and updates the CiliumIdentity CRD. It should be
-// called on agent startup but is idempotent and safe to call again.
-func createIdentityCRD(clientset apiextensionsclient.Interface) error {
-	ciliumCRD := GetPregeneratedCRD(CIDCRDName)
+// constructIdentityCRD builds the CiliumIdentity CRD as it is installed into the
+// cluster, normalized from the pregenerated assets.
+func constructIdentityCRD() (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	ciliumCRD, err := GetPregeneratedCRD(CIDCRDName)
+	if err != nil {
+		return nil, err
+	}
 
 	res := &apiextensionsv1beta1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: k8sconstv2.CIDName,
 			Labels: map[string]string{
-				k8sconstv2.CustomResourceDefinitionSchemaVersionKey: k8sconstv2.CustomResourceDefinitionSchemaVersion,
+				k8sconstv2.CustomResourceDefinitionSchemaVersionKey: pregeneratedSchemaVersion(ciliumCRD),
 			},
 		},
 		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
@@ -275,12 +595,17 @@ func createIdentityCRD(clientset apiextensionsclient.Interface) error {
 				ShortNames: ciliumCRD.Spec.Names.ShortNames,
 				Kind:       ciliumCRD.Spec.Names.Kind,
 			},
-			Subresources: ciliumCRD.Spec.Subresources,
-			Scope:        ciliumCRD.Spec.Scope,
+			AdditionalPrinterColumns: ciliumCRD.Spec.AdditionalPrinterColumns,
+			Subresources:             ciliumCRD.Spec.Subresources,
+			Scope:                    ciliumCRD.Spec.Scope,
+
+			PreserveUnknownFields: ciliumCRD.Spec.PreserveUnknownFields,
 		},
 	}
 
-	return createUpdateCRD(clientset, CIDCRDName, res)
+	applyGroupOverride(res)
+
+	return res, nil
 }
 
 // createUpdateCRD ensures the CRD object is installed into the k8s cluster. It
@@ -289,76 +614,206 @@ func createUpdateCRD(clientset apiextensionsclient.Interface,
 	crdName string,
 	crd *apiextensionsv1beta1.CustomResourceDefinition) error {
 
-	scopedLog := log.WithField("name", crdName)
+	_, err := reconcileCRD(context.TODO(), clientset, crdName, crd, ReconcileOptions{})
+	return err
+}
 
-	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
-		context.TODO(),
-		crd.ObjectMeta.Name,
-		metav1.GetOptions{})
-	if errors.IsNotFound(err) {
-		scopedLog.Info("Creating CRD (CustomResourceDefinition)...")
+// reconcileCRD ensures the CRD object is installed into the k8s cluster
+// according to the given options. It will create or update the CRD and its
+// validation when needed and returns the record of the action taken.
+func reconcileCRD(ctx context.Context, clientset apiextensionsclient.Interface,
+	crdName string,
+	crd *apiextensionsv1beta1.CustomResourceDefinition,
+	opts ReconcileOptions) (record *crdReconcileRecord, err error) {
 
-		clusterCRD, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Create(
-			context.TODO(),
-			crd,
-			metav1.CreateOptions{})
-		// This occurs when multiple agents race to create the CRD. Since another has
-		// created it, it will also update it, hence the non-error return.
-		if errors.IsAlreadyExists(err) {
-			return nil
+	toVersion := crd.Labels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey]
+	if toVersion == "" {
+		toVersion = k8sconstv2.CustomResourceDefinitionSchemaVersion
+	}
+
+	// The structured fields are shared by every log line of this reconcile
+	// so that log pipelines can filter by CRD and phase without parsing
+	// the human-readable messages.
+	scopedLog := log.WithFields(logrus.Fields{
+		"name":           crdName,
+		"crd_name":       crd.ObjectMeta.Name,
+		"schema_version": toVersion,
+	})
+	record = &crdReconcileRecord{
+		Name:      crd.ObjectMeta.Name,
+		Action:    "none",
+		ToVersion: toVersion,
+	}
+	reconcileSince := spanstat.Start()
+	defer func() {
+		record.DurationMs = int64(reconcileSince.Seconds() * 1000)
+		if err != nil {
+			record.Error = err.Error()
+		}
+		crdInstallMetrics.ObserveInstallDuration(record.Name, reconcileSince.Seconds())
+		emitReconcileAudit(record)
+	}()
+
+	if opts.MaxStartupDelay > 0 {
+		delay := time.Duration(rand.Int63n(int64(opts.MaxStartupDelay)))
+		scopedLog.WithField("delay", delay).Debug("Delaying CRD reconciliation to stagger agent startup")
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return record, ctx.Err()
 		}
 	}
-	if err != nil {
-		return err
+
+	if err := validateCRDName(crd); err != nil {
+		return record, err
+	}
+
+	if err := validatePreserveUnknownFields(crd); err != nil {
+		return record, err
+	}
+
+	if err := ensurePreferredVersionOrder(crd); err != nil {
+		return record, err
 	}
 
-	scopedLog.Debug("Checking if CRD (CustomResourceDefinition) needs update...")
+	// created tracks whether this invocation created the CRD, as opposed to
+	// having found it in the cluster. Cleanup on failure is only allowed for
+	// CRDs we created ourselves.
+	created := false
 
-	if crd.Spec.Validation != nil && needsUpdate(clusterCRD) {
-		scopedLog.Info("Updating CRD (CustomResourceDefinition)...")
+	var clusterCRD *apiextensionsv1beta1.CustomResourceDefinition
+	err = retryOnTransientError(scopedLog, func() error {
+		var getErr error
+		clusterCRD, getErr = getClusterCRD(clientset, crd.ObjectMeta.Name)
+		return getErr
+	})
+	if errors.IsNotFound(err) {
+		record.Action = "create"
+		if opts.DryRun {
+			// Validate the create against the apiserver, including
+			// admission, without persisting anything.
+			err = retryOnTransientError(scopedLog, func() error {
+				_, createErr := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Create(
+					ctx,
+					crd,
+					metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+				return createErr
+			})
+			if err != nil {
+				return record, err
+			}
+			scopedLog.WithField("phase", "create").Info("CRD (CustomResourceDefinition) would be created (dry run)")
+			return record, nil
+		}
 
-		// Update the CRD with the validation schema.
-		err = wait.Poll(500*time.Millisecond, 60*time.Second, func() (bool, error) {
+		scopedLog.WithField("phase", "create").Info("Creating CRD (CustomResourceDefinition)...")
+
+		err = retryOnTransientError(scopedLog, func() error {
+			var createErr error
+			clusterCRD, createErr = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Create(
+				ctx,
+				crd,
+				metav1.CreateOptions{})
+			return createErr
+		})
+		created = err == nil
+		// This occurs when multiple agents race to create the CRD. The
+		// winner may have crashed before writing the full schema, so
+		// re-read the CRD and fall through to the update logic below to
+		// ensure it converges regardless of which agent created it.
+		if errors.IsAlreadyExists(err) {
 			clusterCRD, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
-				context.TODO(),
+				ctx,
 				crd.ObjectMeta.Name,
 				metav1.GetOptions{})
-			if err != nil {
-				return false, err
+		}
+	}
+	if err != nil {
+		crdInstallMetrics.IncInstallError(record.Name, "create")
+		return record, err
+	}
+
+	if created {
+		emitCRDEvent(CRDInstalledReason, crd.ObjectMeta.Name,
+			crd.Labels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey])
+	}
+
+	if !created {
+		record.Action = "none"
+		record.FromVersion = clusterCRD.Labels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey]
+	}
+
+	if err := validateClusterCRD(clusterCRD); err != nil {
+		scopedLog.WithError(err).Warning("Cluster CRD is malformed, refusing to reconcile it")
+		return record, err
+	}
+
+	if skewErr := CheckCRDSchemaSkew(crd, clusterCRD); skewErr != nil {
+		scopedLog.WithError(skewErr).Warning("Cluster CRD schema is newer than this agent's; was the agent downgraded?")
+	}
+
+	paused := crdReconcilePaused(clusterCRD)
+	switch {
+	case paused:
+		scopedLog.Info("CRD reconciliation is paused via annotation, skipping update")
+		record.Action = "paused"
+	case opts.CreateOnly && !created:
+		scopedLog.Debug("Create-only reconciliation, skipping update check")
+	default:
+		if _, hasLabel := clusterCRD.Labels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey]; !hasLabel {
+			switch unlabeledCRDPolicy {
+			case UnlabeledCRDSkip:
+				scopedLog.Info("Existing CRD is not managed by Cilium, skipping update")
+				record.Action = "skip"
+				return record, nil
+			case UnlabeledCRDError:
+				return record, fmt.Errorf("existing CRD %s is not managed by Cilium: missing %s label",
+					crd.ObjectMeta.Name, k8sconstv2.CustomResourceDefinitionSchemaVersionKey)
 			}
+		}
 
-			// This seems too permissive but we only get here if the version is
-			// different per needsUpdate above. If so, we want to update on any
-			// validation change including adding or removing validation.
-			if needsUpdate(clusterCRD) {
-				scopedLog.Debug("CRD validation is different, updating it...")
-
-				clusterCRD.ObjectMeta.Labels = crd.ObjectMeta.Labels
-				clusterCRD.Spec = crd.Spec
-
-				_, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Update(
-					context.TODO(),
-					clusterCRD,
-					metav1.UpdateOptions{})
-				if err == nil {
-					return true, nil
-				}
+		scopedLog.Debug("Checking if CRD (CustomResourceDefinition) needs update...")
 
-				scopedLog.WithError(err).Debug("Unable to update CRD validation")
-				return false, err
+		if crd.Spec.Validation == nil {
+			// Nothing to reconcile the cluster schema against. This
+			// only happens with a broken pregenerated asset; say so
+			// instead of silently leaving a possibly schema-less
+			// cluster CRD in place.
+			scopedLog.Warning("Compiled-in CRD carries no validation schema, skipping schema reconciliation")
+		} else if needsUpdate(crd, clusterCRD) {
+			record.Action = "update"
+			if !opts.DryRun {
+				scopedLog.WithField("phase", "update").Info("Updating CRD (CustomResourceDefinition)...")
 			}
 
-			return true, nil
-		})
-		if err != nil {
-			scopedLog.WithError(err).Error("Unable to update CRD")
-			return err
+			reconcileFn := updateCRD
+			if opts.serverSideApplyCapable() {
+				reconcileFn = applyCRD
+			}
+			if err := reconcileFn(clientset, scopedLog, crd, opts.DryRun); err != nil {
+				scopedLog.WithError(err).Error("Unable to update CRD")
+				crdInstallMetrics.IncInstallError(record.Name, "update")
+				return record, err
+			}
+			if !opts.DryRun {
+				emitCRDEvent(CRDUpdatedReason, crd.ObjectMeta.Name,
+					crd.Labels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey])
+			}
 		}
 	}
 
-	// wait for the CRD to be established
-	scopedLog.Debug("Waiting for CRD (CustomResourceDefinition) to be available...")
-	err = wait.Poll(500*time.Millisecond, 60*time.Second, func() (bool, error) {
+	if opts.DryRun {
+		return record, nil
+	}
+
+	// wait for the CRD to be established. The wait is bounded by the poll
+	// timeout but aborts promptly when ctx is cancelled, e.g. on agent
+	// shutdown.
+	scopedLog.WithField("phase", "wait").Debug("Waiting for CRD (CustomResourceDefinition) to be available...")
+	sinceStart := spanstat.Start()
+	waitCtx, waitCancel := context.WithTimeout(ctx, opts.Poll.timeout())
+	defer waitCancel()
+	err = opts.Poll.poll(waitCtx, func() (bool, error) {
 		for _, cond := range clusterCRD.Status.Conditions {
 			switch cond.Type {
 			case apiextensionsv1beta1.Established:
@@ -367,37 +822,431 @@ func createUpdateCRD(clientset apiextensionsclient.Interface,
 				}
 			case apiextensionsv1beta1.NamesAccepted:
 				if cond.Status == apiextensionsv1beta1.ConditionFalse {
-					scopedLog.WithError(goerrors.New(cond.Reason)).Error("Name conflict for CRD")
-					return false, err
+					// The condition message names the existing CRD or
+					// built-in type claiming the plural/kind; without it
+					// operators cannot tell what to resolve.
+					nameErr := fmt.Errorf("names not accepted for CRD %s: %s: %s",
+						crd.ObjectMeta.Name, cond.Reason, cond.Message)
+					scopedLog.WithError(nameErr).Error("Name conflict for CRD")
+					return false, nameErr
 				}
 			}
 		}
-		clusterCRD, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
-			context.TODO(),
-			crd.ObjectMeta.Name,
-			metav1.GetOptions{})
+		clusterCRD, err = getClusterCRD(clientset, crd.ObjectMeta.Name)
 		if err != nil {
 			return false, err
 		}
 		return false, err
 	})
+	if err == wait.ErrWaitTimeout && ctx.Err() != nil {
+		err = ctx.Err()
+	}
 	if err != nil {
+		crdInstallMetrics.IncInstallError(record.Name, "wait")
+
+		// Never mutate a CRD whose reconciliation has been paused, not
+		// even to clean up after a failed establishment wait.
+		if paused {
+			return record, err
+		}
+
+		// Only clean up a CRD which this invocation created, and only
+		// when the caller explicitly opted in. Deleting a CRD which was
+		// found in the cluster would destroy a resource this agent does
+		// not own, and even a CRD we created ourselves is usually valid
+		// despite a slow establishment; leaving it in place lets the
+		// next reconcile retry without an outage.
+		if !created || !opts.DeleteOnFailure {
+			scopedLog.WithError(err).Warning(
+				"Leaving CRD in place after failed establishment wait; the next reconcile will retry")
+			return record, err
+		}
+
+		scopedLog.WithError(err).Warning(
+			"Deleting CRD after failed establishment wait for a clean retry")
+
+		// A rejection by an admission webhook is a cluster policy
+		// decision; deleting the CRD in response would be destructive
+		// and would not resolve the denial.
+		if _, denied := admissionWebhookDenied(err); denied {
+			return record, err
+		}
+
+		// Delete with foreground propagation and wait for the deletion to
+		// complete so that a retry does not run into a half-deleted CRD.
+		propagationPolicy := metav1.DeletePropagationForeground
 		deleteErr := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Delete(
-			context.TODO(),
+			ctx,
 			crd.ObjectMeta.Name,
-			metav1.DeleteOptions{})
+			metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
 		if deleteErr != nil {
-			return fmt.Errorf("unable to delete k8s %s CRD %s. Deleting CRD due: %s",
+			return record, fmt.Errorf("unable to delete k8s %s CRD %s. Deleting CRD due: %s",
 				crdName, deleteErr, err)
 		}
+
+		deleteCtx, deleteCancel := context.WithTimeout(ctx, opts.Poll.timeout())
+		defer deleteCancel()
+		waitErr := opts.Poll.poll(deleteCtx, func() (bool, error) {
+			_, getErr := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+				ctx,
+				crd.ObjectMeta.Name,
+				metav1.GetOptions{})
+			if errors.IsNotFound(getErr) {
+				return true, nil
+			}
+			return false, getErr
+		})
+		if waitErr != nil {
+			return record, fmt.Errorf("unable to confirm deletion of k8s %s CRD %s. Deleting CRD due: %s",
+				crdName, waitErr, err)
+		}
+
+		return record, err
+	}
+
+	crdEstablishmentDuration.WithLabelValues(crd.ObjectMeta.Name).Observe(sinceStart.Seconds())
+
+	// Re-read the CRD so the reported schema version reflects what actually
+	// ended up in the cluster, which can be a newer version this agent left
+	// untouched.
+	if finalCRD, getErr := getClusterCRD(clientset, crd.ObjectMeta.Name); getErr == nil {
+		record.InstalledVersion = finalCRD.Labels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey]
+	}
+
+	action := "unchanged"
+	switch record.Action {
+	case "create":
+		action = "created"
+	case "update":
+		action = "updated"
+	}
+	scopedLog.WithField("action", action).Info("CRD (CustomResourceDefinition) is installed and up-to-date")
+	return record, nil
+}
+
+// maxUpdateRetries is the maximum number of attempts updateCRD makes when
+// the apiserver rejects the update with a resource-version conflict.
+const maxUpdateRetries = 5
+
+// maxTransientErrorRetries is the maximum number of additional attempts made
+// when the apiserver fails a CRD operation with a transient error, e.g. 429
+// Too Many Requests, a server timeout or a connection reset.
+const maxTransientErrorRetries = 4
+
+// maxRetryAfterDelay caps the retry delay so that the bounded retries cannot
+// consume the whole establishment budget.
+const maxRetryAfterDelay = 10 * time.Second
+
+// isTransientAPIError returns true for apiserver or network failures which a
+// bounded retry can reasonably outlast: throttling, server timeouts and
+// connection drops. Permanent rejections like Forbidden or Invalid are not
+// transient; retrying them only burns the budget without changing the
+// outcome.
+func isTransientAPIError(err error) bool {
+	if errors.IsTooManyRequests(err) ||
+		errors.IsServerTimeout(err) ||
+		errors.IsTimeout(err) ||
+		errors.IsServiceUnavailable(err) ||
+		errors.IsInternalError(err) {
+		return true
+	}
+	return utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err)
+}
+
+// retryOnTransientError runs the given CRD operation and retries it a bounded
+// number of times on transient apiserver or network failures, with an
+// exponentially growing delay. A Retry-After suggestion from the apiserver
+// overrides the computed delay. Any other outcome is returned as-is; without
+// this a single connection reset during startup would fail the whole CRD
+// install and force an agent restart.
+func retryOnTransientError(scopedLog *logrus.Entry, do func() error) error {
+	var err error
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err = do()
+		if err == nil || !isTransientAPIError(err) || attempt >= maxTransientErrorRetries {
+			return err
+		}
+
+		delay := backoff
+		backoff *= 2
+		if seconds, ok := errors.SuggestsClientDelay(err); ok && seconds > 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+		if delay > maxRetryAfterDelay {
+			delay = maxRetryAfterDelay
+		}
+
+		scopedLog.WithError(err).WithField("delay", delay).Debug("Transient apiserver failure for CRD operation, retrying after delay...")
+		time.Sleep(delay)
+	}
+}
+
+// updateCRD updates the CRD in the cluster with the pregenerated schema using
+// optimistic concurrency. The object is re-read on every attempt and the
+// Update call carries the resourceVersion from that read, so a concurrent
+// writer causes a conflict which is retried a bounded number of times instead
+// of silently clobbering the concurrent write.
+func updateCRD(clientset apiextensionsclient.Interface, scopedLog *logrus.Entry,
+	crd *apiextensionsv1beta1.CustomResourceDefinition, dryRun bool) error {
+
+	updateOpts := metav1.UpdateOptions{}
+	if dryRun {
+		updateOpts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	var err error
+
+	for retry := 0; retry < maxUpdateRetries; retry++ {
+		var clusterCRD *apiextensionsv1beta1.CustomResourceDefinition
+
+		err = retryOnTransientError(scopedLog, func() error {
+			var getErr error
+			clusterCRD, getErr = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+				context.TODO(),
+				crd.ObjectMeta.Name,
+				metav1.GetOptions{})
+			return getErr
+		})
+		if err != nil {
+			return err
+		}
+
+		// This seems too permissive but we only get here if the version is
+		// different per needsUpdate above. If so, we want to update on any
+		// validation change including adding or removing validation.
+		if !needsUpdate(crd, clusterCRD) {
+			return nil
+		}
+
+		scopedLog.Debug("CRD validation is different, updating it...")
+
+		// The diff is only worth computing when someone can see it.
+		if scopedLog.Logger.IsLevelEnabled(logrus.DebugLevel) {
+			if diff, diffErr := DiffCRDSchema(crd, clusterCRD); diffErr == nil && diff != "" {
+				scopedLog.WithField("diff", diff).Debug("CRD schema difference")
+			}
+		}
+
+		// Record how far behind the cluster schema was. Clusters which
+		// skipped intermediate versions are a risk signal for migrations.
+		clusterVersion := clusterCRD.Labels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey]
+		if clusterVersion == "" {
+			clusterVersion = "unknown"
+		}
+		scopedLog.WithFields(logrus.Fields{
+			"phase":       "update",
+			"fromVersion": clusterVersion,
+			"toVersion":   expectedSchemaVersion(crd).String(),
+		}).Info("Upgrading CRD schema version")
+
+		mergedShortNames := mergeShortNames(crd.Spec.Names.ShortNames, clusterCRD.Spec.Names.ShortNames)
+
+		clusterCRD.ObjectMeta.Labels = crd.ObjectMeta.Labels
+		clusterCRD.Spec = crd.Spec
+		clusterCRD.Spec.Names.ShortNames = mergedShortNames
+
+		err = retryOnTransientError(scopedLog, func() error {
+			_, updateErr := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Update(
+				context.TODO(),
+				clusterCRD,
+				updateOpts)
+			return updateErr
+		})
+		if err == nil {
+			if dryRun {
+				scopedLog.WithField("phase", "update").Info("CRD (CustomResourceDefinition) would be updated (dry run)")
+			}
+			return nil
+		}
+		// An admission webhook intercepting CRD writes rejected the
+		// update. This is a cluster policy decision, not a transient
+		// failure: name the denying webhook and leave the CRD alone.
+		if webhook, denied := admissionWebhookDenied(err); denied {
+			return fmt.Errorf("update of CRD %s was denied by admission webhook %q; adjust the webhook policy and retry: %s",
+				crd.ObjectMeta.Name, webhook, err)
+		}
+		if !errors.IsConflict(err) {
+			// Forbidden, invalid and other permanent rejections cannot
+			// be resolved by re-reading and retrying; fail fast instead
+			// of burning the remaining retries.
+			return err
+		}
+
+		scopedLog.WithError(err).Debug("CRD update conflicted with a concurrent writer, retrying...")
+	}
+
+	return err
+}
+
+// crdFieldManager is the field manager name under which server-side apply
+// records the fields owned by this agent.
+const crdFieldManager = "cilium-agent"
+
+// applyCRD reconciles the CRD in the cluster with server-side apply instead
+// of the optimistic Get+Update cycle of updateCRD. The apiserver tracks the
+// fields set by this agent under the cilium-agent field manager, so fields
+// set by other managers are left alone and conflicts are surfaced explicitly
+// instead of being clobbered. Requires an apiserver with the ServerSideApply
+// capability.
+func applyCRD(clientset apiextensionsclient.Interface, scopedLog *logrus.Entry,
+	crd *apiextensionsv1beta1.CustomResourceDefinition, dryRun bool) error {
+
+	// The apply patch must carry apiVersion and kind.
+	applyObj := crd.DeepCopy()
+	applyObj.TypeMeta = metav1.TypeMeta{
+		APIVersion: apiextensionsv1beta1.SchemeGroupVersion.String(),
+		Kind:       "CustomResourceDefinition",
+	}
+
+	data, err := json.Marshal(applyObj)
+	if err != nil {
+		return fmt.Errorf("unable to marshal CRD %s for apply: %w", crd.ObjectMeta.Name, err)
+	}
+
+	patchOpts := metav1.PatchOptions{FieldManager: crdFieldManager}
+	if dryRun {
+		patchOpts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	scopedLog.Debug("Applying CRD (CustomResourceDefinition) server-side...")
+
+	err = retryOnTransientError(scopedLog, func() error {
+		_, patchErr := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Patch(
+			context.TODO(),
+			crd.ObjectMeta.Name,
+			types.ApplyPatchType,
+			data,
+			patchOpts)
+		return patchErr
+	})
+	if err != nil {
+		if webhook, denied := admissionWebhookDenied(err); denied {
+			return fmt.Errorf("apply of CRD %s was denied by admission webhook %q; adjust the webhook policy and retry: %s",
+				crd.ObjectMeta.Name, webhook, err)
+		}
 		return err
 	}
 
-	scopedLog.Info("CRD (CustomResourceDefinition) is installed and up-to-date")
 	return nil
 }
 
-func needsUpdate(clusterCRD *apiextensionsv1beta1.CustomResourceDefinition) bool {
+// admissionWebhookDeniedRegexp matches the status message the apiserver
+// returns when an admission webhook rejects a request and captures the name
+// of the denying webhook.
+var admissionWebhookDeniedRegexp = regexp.MustCompile(`admission webhook "([^"]+)" denied the request`)
+
+// admissionWebhookDenied reports whether the given error is a rejection by an
+// admission webhook, e.g. a policy engine intercepting CRD writes, and
+// returns the name of the denying webhook.
+func admissionWebhookDenied(err error) (string, bool) {
+	if err == nil {
+		return "", false
+	}
+	if match := admissionWebhookDeniedRegexp.FindStringSubmatch(err.Error()); match != nil {
+		return match[1], true
+	}
+	return "", false
+}
+
+// validateCRDName checks that the CRD's metadata.name is well-formed before
+// it is sent to the apiserver. The name must be the plural name followed by
+// the group and conform to DNS subdomain rules. This catches mistakes in the
+// pregenerated assets or constants locally instead of with an apiserver
+// round-trip.
+func validateCRDName(crd *apiextensionsv1beta1.CustomResourceDefinition) error {
+	expectedName := crd.Spec.Names.Plural + "." + crd.Spec.Group
+	if crd.ObjectMeta.Name != expectedName {
+		return fmt.Errorf("CRD name %q does not match <plural>.<group> %q",
+			crd.ObjectMeta.Name, expectedName)
+	}
+
+	if errs := validation.IsDNS1123Subdomain(crd.ObjectMeta.Name); len(errs) > 0 {
+		return fmt.Errorf("CRD name %q is not a valid DNS subdomain: %s",
+			crd.ObjectMeta.Name, strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// validatePreserveUnknownFields rejects CRDs which explicitly enable
+// preserveUnknownFields. The Cilium CRDs rely on structural schemas for
+// validation and pruning, and apiextensions v1 forbids preserving unknown
+// fields outright; a template turning it on would silently change pruning
+// semantics now and break the eventual migration to v1.
+func validatePreserveUnknownFields(crd *apiextensionsv1beta1.CustomResourceDefinition) error {
+	if crd.Spec.PreserveUnknownFields != nil && *crd.Spec.PreserveUnknownFields {
+		return fmt.Errorf("CRD %s sets preserveUnknownFields=true, which is incompatible with structural schemas",
+			crd.ObjectMeta.Name)
+	}
+	return nil
+}
+
+// ensurePreferredVersionOrder validates the Versions slice of the given CRD
+// and moves the storage version to the front, as the order determines which
+// version kubectl prefers and which version the apiserver reports as
+// preferred. Exactly one version must be marked as the storage version. CRDs
+// without an explicit Versions slice are left untouched since their single
+// Spec.Version is implicitly both served and storage.
+func ensurePreferredVersionOrder(crd *apiextensionsv1beta1.CustomResourceDefinition) error {
+	if len(crd.Spec.Versions) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]struct{}, len(crd.Spec.Versions))
+	storage := -1
+	for i, version := range crd.Spec.Versions {
+		if _, ok := seen[version.Name]; ok {
+			return fmt.Errorf("CRD %s declares version %s more than once",
+				crd.ObjectMeta.Name, version.Name)
+		}
+		seen[version.Name] = struct{}{}
+
+		if !version.Storage {
+			continue
+		}
+		if storage >= 0 {
+			return fmt.Errorf("CRD %s declares more than one storage version: %s and %s",
+				crd.ObjectMeta.Name, crd.Spec.Versions[storage].Name, version.Name)
+		}
+		storage = i
+	}
+	if storage < 0 {
+		return fmt.Errorf("CRD %s declares no storage version", crd.ObjectMeta.Name)
+	}
+
+	if storage > 0 {
+		versions := crd.Spec.Versions
+		storageVersion := versions[storage]
+		copy(versions[1:storage+1], versions[:storage])
+		versions[0] = storageVersion
+	}
+
+	return nil
+}
+
+// crdReconcilePaused returns true if reconciliation of the given CRD has been
+// paused via the CRDReconcilePausedAnnotation annotation.
+func crdReconcilePaused(clusterCRD *apiextensionsv1beta1.CustomResourceDefinition) bool {
+	paused, err := strconv.ParseBool(clusterCRD.Annotations[CRDReconcilePausedAnnotation])
+	return err == nil && paused
+}
+
+// validateClusterCRD checks that the CRD retrieved from the cluster is
+// well-formed before it is compared against the pregenerated CRD. In mixed or
+// aggregated apiserver environments the returned object may not round-trip
+// cleanly, so guard against a CRD without any version information in its spec
+// instead of assuming it is populated.
+func validateClusterCRD(clusterCRD *apiextensionsv1beta1.CustomResourceDefinition) error {
+	if clusterCRD.Spec.Version == "" && len(clusterCRD.Spec.Versions) == 0 {
+		return fmt.Errorf("malformed CRD %s in cluster: spec contains no version information",
+			clusterCRD.ObjectMeta.Name)
+	}
+	return nil
+}
+
+func needsUpdate(crd, clusterCRD *apiextensionsv1beta1.CustomResourceDefinition) bool {
 	if clusterCRD.Spec.Validation == nil {
 		// no validation detected
 		return true
@@ -409,10 +1258,118 @@ func needsUpdate(clusterCRD *apiextensionsv1beta1.CustomResourceDefinition) bool
 	}
 
 	clusterVersion, err := versioncheck.Version(v)
-	if err != nil || clusterVersion.LT(comparableCRDSchemaVersion) {
-		// version in cluster is either unparsable or smaller than current version
+	if err != nil || clusterVersion.LT(expectedSchemaVersion(crd)) {
+		// version in cluster is either unparsable or smaller than the
+		// version expected for this CRD
+		return true
+	}
+
+	if deepSchemaComparison &&
+		!apiequality.Semantic.DeepEqual(clusterCRD.Spec.Validation, crd.Spec.Validation) {
+		// the validation schema in the cluster diverged from the
+		// pregenerated one, e.g. by a manual edit which left the
+		// schema version label intact
 		return true
 	}
 
+	if !apiequality.Semantic.DeepEqual(clusterCRD.Spec.AdditionalPrinterColumns, crd.Spec.AdditionalPrinterColumns) {
+		// the additional printer columns in the cluster differ from the
+		// pregenerated ones, e.g. a column was added, changed or removed
+		return true
+	}
+
+	for _, shortName := range crd.Spec.Names.ShortNames {
+		if !sliceContains(clusterCRD.Spec.Names.ShortNames, shortName) {
+			// a pregenerated short name is missing in the cluster
+			return true
+		}
+	}
+
+	return false
+}
+
+// ErrCRDSchemaSkew is wrapped by the error returned from CheckCRDSchemaSkew
+// when the cluster carries a newer CRD schema than this agent understands.
+var ErrCRDSchemaSkew = goerrors.New("cluster CRD schema version is newer than the agent's")
+
+// CheckCRDSchemaSkew compares the schema version of the cluster CRD against
+// the version this agent would install and returns an error wrapping
+// ErrCRDSchemaSkew when the cluster schema is newer. Such skew is left in
+// place by needsUpdate on purpose, but it usually means a newer agent ran
+// against this cluster before, e.g. during an accidental downgrade, and the
+// operator should know. Cluster CRDs without a parsable version label are
+// not considered skewed.
+func CheckCRDSchemaSkew(crd, clusterCRD *apiextensionsv1beta1.CustomResourceDefinition) error {
+	v, ok := clusterCRD.Labels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey]
+	if !ok {
+		return nil
+	}
+
+	clusterVersion, err := versioncheck.Version(v)
+	if err != nil {
+		return nil
+	}
+
+	if expected := expectedSchemaVersion(crd); clusterVersion.GT(expected) {
+		return fmt.Errorf("%w: CRD %s carries schema version %s, this agent expects %s",
+			ErrCRDSchemaSkew, clusterCRD.ObjectMeta.Name, clusterVersion, expected)
+	}
+
+	return nil
+}
+
+// CompareCRDSchemaVersion parses the given schema version label value and
+// compares it to the embedded compiled-in schema version, returning -1 when
+// the label is older, 0 when equal and +1 when newer. External tooling
+// deciding whether to trigger an upgrade can reuse this instead of
+// duplicating the label parsing and version comparison.
+func CompareCRDSchemaVersion(clusterVersionLabel string) (int, error) {
+	clusterVersion, err := versioncheck.Version(clusterVersionLabel)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse CRD schema version %q: %w", clusterVersionLabel, err)
+	}
+
+	switch {
+	case clusterVersion.LT(comparableCRDSchemaVersion):
+		return -1, nil
+	case clusterVersion.GT(comparableCRDSchemaVersion):
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// expectedSchemaVersion returns the schema version the given pregenerated CRD
+// is expected to carry in the cluster. It is read from the CRD's own label so
+// that each CRD can evolve its schema version independently, and falls back
+// to the global compiled-in version for CRDs without a parsable label.
+func expectedSchemaVersion(crd *apiextensionsv1beta1.CustomResourceDefinition) go_version.Version {
+	if v := crd.Labels[k8sconstv2.CustomResourceDefinitionSchemaVersionKey]; v != "" {
+		if parsed, err := versioncheck.Version(v); err == nil {
+			return parsed
+		}
+	}
+	return comparableCRDSchemaVersion
+}
+
+func sliceContains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
 	return false
 }
+
+// mergeShortNames combines the pregenerated short names with any additional
+// short names a user added to the cluster CRD, so that reconciling the CRD
+// does not remove non-conflicting user customizations.
+func mergeShortNames(desired, existing []string) []string {
+	merged := make([]string, 0, len(desired)+len(existing))
+	merged = append(merged, desired...)
+	for _, shortName := range existing {
+		if !sliceContains(merged, shortName) {
+			merged = append(merged, shortName)
+		}
+	}
+	return merged
+}
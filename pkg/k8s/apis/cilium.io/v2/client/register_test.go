@@ -17,15 +17,26 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
+	goerrors "errors"
 	"regexp"
 	"testing"
 
 	ciliumv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	k8sversion "github.com/cilium/cilium/pkg/k8s/version"
 	"github.com/cilium/cilium/pkg/policy/api"
 
 	. "gopkg.in/check.v1"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 )
 
 // Hook up gocheck into the "go test" runner.
@@ -35,6 +46,14 @@ type CiliumV2RegisterSuite struct{}
 
 var _ = Suite(&CiliumV2RegisterSuite{})
 
+// mustConstructCNPCRD builds the CNP CRD from the pregenerated assets,
+// failing the test if the assets cannot be loaded.
+func (s *CiliumV2RegisterSuite) mustConstructCNPCRD(c *C) *apiextensionsv1beta1.CustomResourceDefinition {
+	crd, err := constructCNPCRD()
+	c.Assert(err, IsNil)
+	return crd
+}
+
 func (s *CiliumV2RegisterSuite) getTestUpToDateDefinition() *apiextensionsv1beta1.CustomResourceDefinition {
 	return &apiextensionsv1beta1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
@@ -55,7 +74,7 @@ func (s *CiliumV2RegisterSuite) TestNeedsUpdateNoValidation(c *C) {
 
 	crd.Spec.Validation = nil
 
-	c.Assert(needsUpdate(crd), Equals, true)
+	c.Assert(needsUpdate(s.getTestUpToDateDefinition(), crd), Equals, true)
 }
 
 func (s *CiliumV2RegisterSuite) TestNeedsUpdateNoLabels(c *C) {
@@ -63,7 +82,7 @@ func (s *CiliumV2RegisterSuite) TestNeedsUpdateNoLabels(c *C) {
 
 	crd.Labels = nil
 
-	c.Assert(needsUpdate(crd), Equals, true)
+	c.Assert(needsUpdate(s.getTestUpToDateDefinition(), crd), Equals, true)
 }
 
 func (s *CiliumV2RegisterSuite) TestNeedsUpdateNoVersionLabel(c *C) {
@@ -71,7 +90,7 @@ func (s *CiliumV2RegisterSuite) TestNeedsUpdateNoVersionLabel(c *C) {
 
 	crd.Labels = map[string]string{"test": "test"}
 
-	c.Assert(needsUpdate(crd), Equals, true)
+	c.Assert(needsUpdate(s.getTestUpToDateDefinition(), crd), Equals, true)
 }
 
 func (s *CiliumV2RegisterSuite) TestNeedsUpdateOlderVersion(c *C) {
@@ -79,7 +98,7 @@ func (s *CiliumV2RegisterSuite) TestNeedsUpdateOlderVersion(c *C) {
 
 	crd.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
 
-	c.Assert(needsUpdate(crd), Equals, true)
+	c.Assert(needsUpdate(s.getTestUpToDateDefinition(), crd), Equals, true)
 }
 
 func (s *CiliumV2RegisterSuite) TestNeedsUpdateCorruptedVersion(c *C) {
@@ -87,7 +106,169 @@ func (s *CiliumV2RegisterSuite) TestNeedsUpdateCorruptedVersion(c *C) {
 
 	crd.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "totally-not-semver"
 
-	c.Assert(needsUpdate(crd), Equals, true)
+	c.Assert(needsUpdate(s.getTestUpToDateDefinition(), crd), Equals, true)
+}
+
+func (s *CiliumV2RegisterSuite) TestUpdateCRDRetryOnConflict(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+
+	clusterCRD := crd.DeepCopy()
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+
+	clientset := fake.NewSimpleClientset(clusterCRD)
+
+	conflicts := 0
+	clientset.PrependReactor("update", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if conflicts == 0 {
+				conflicts++
+				return true, nil, errors.NewConflict(
+					schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+					crd.Name,
+					goerrors.New("the object has been modified"))
+			}
+			return false, nil, nil
+		})
+
+	c.Assert(updateCRD(clientset, log, crd, false), IsNil)
+	c.Assert(conflicts, Equals, 1)
+
+	updated, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(needsUpdate(crd, updated), Equals, false)
+}
+
+func (s *CiliumV2RegisterSuite) TestCreateUpdateCRDAlreadyExistsRace(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+
+	// The CRD as left behind by an agent which created it with an outdated
+	// schema and crashed before updating it.
+	winnerCRD := crd.DeepCopy()
+	winnerCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+	winnerCRD.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{
+			Type:   apiextensionsv1beta1.Established,
+			Status: apiextensionsv1beta1.ConditionTrue,
+		},
+	}
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			// The other agent won the race in between our Get and Create.
+			c.Assert(clientset.Tracker().Add(winnerCRD), IsNil)
+			return true, nil, errors.NewAlreadyExists(
+				schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+				crd.Name)
+		})
+
+	c.Assert(createUpdateCRD(clientset, CNPCRDName, crd), IsNil)
+
+	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey],
+		Equals, ciliumv2.CustomResourceDefinitionSchemaVersion)
+}
+
+func (s *CiliumV2RegisterSuite) TestCRDReconcilePausedAnnotation(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+
+	clusterCRD := crd.DeepCopy()
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+	clusterCRD.Annotations = map[string]string{
+		CRDReconcilePausedAnnotation: "true",
+	}
+	clusterCRD.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{
+			Type:   apiextensionsv1beta1.Established,
+			Status: apiextensionsv1beta1.ConditionTrue,
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(clusterCRD)
+
+	// While paused, the outdated schema version must be left alone.
+	c.Assert(createUpdateCRD(clientset, CNPCRDName, crd), IsNil)
+	current, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(current.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey], Equals, "0.9")
+
+	// Removing the annotation resumes normal reconciliation.
+	current.Annotations = nil
+	_, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Update(
+		context.TODO(), current, metav1.UpdateOptions{})
+	c.Assert(err, IsNil)
+
+	c.Assert(createUpdateCRD(clientset, CNPCRDName, crd), IsNil)
+	current, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(current.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey],
+		Equals, ciliumv2.CustomResourceDefinitionSchemaVersion)
+}
+
+func (s *CiliumV2RegisterSuite) TestUnlabeledCRDPolicy(c *C) {
+	defer func() {
+		c.Assert(SetUnlabeledCRDPolicy(UnlabeledCRDTakeover), IsNil)
+	}()
+
+	crd := s.mustConstructCNPCRD(c)
+
+	newClientset := func() *fake.Clientset {
+		clusterCRD := crd.DeepCopy()
+		clusterCRD.Labels = nil
+		clusterCRD.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+			{
+				Type:   apiextensionsv1beta1.Established,
+				Status: apiextensionsv1beta1.ConditionTrue,
+			},
+		}
+		return fake.NewSimpleClientset(clusterCRD)
+	}
+
+	c.Assert(SetUnlabeledCRDPolicy(UnlabeledCRDSkip), IsNil)
+	clientset := newClientset()
+	c.Assert(createUpdateCRD(clientset, CNPCRDName, crd), IsNil)
+	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(clusterCRD.Labels, HasLen, 0)
+
+	c.Assert(SetUnlabeledCRDPolicy(UnlabeledCRDError), IsNil)
+	clientset = newClientset()
+	c.Assert(createUpdateCRD(clientset, CNPCRDName, crd), ErrorMatches, ".*not managed by Cilium.*")
+
+	c.Assert(SetUnlabeledCRDPolicy(UnlabeledCRDTakeover), IsNil)
+	clientset = newClientset()
+	c.Assert(createUpdateCRD(clientset, CNPCRDName, crd), IsNil)
+	clusterCRD, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey],
+		Equals, ciliumv2.CustomResourceDefinitionSchemaVersion)
+
+	c.Assert(SetUnlabeledCRDPolicy("bogus"), ErrorMatches, "unknown unlabeled CRD policy.*")
+}
+
+func (s *CiliumV2RegisterSuite) TestValidateClusterCRD(c *C) {
+	crd := s.getTestUpToDateDefinition()
+
+	crd.Spec.Version = ciliumv2.CustomResourceDefinitionVersion
+	c.Assert(validateClusterCRD(crd), IsNil)
+
+	crd.Spec.Version = ""
+	c.Assert(validateClusterCRD(crd), ErrorMatches, "malformed CRD .*")
+
+	crd.Spec.Versions = []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+		{
+			Name:   ciliumv2.CustomResourceDefinitionVersion,
+			Served: true,
+		},
+	}
+	c.Assert(validateClusterCRD(crd), IsNil)
 }
 
 func (s *CiliumV2RegisterSuite) TestFQDNNameRegex(c *C) {
@@ -144,3 +325,448 @@ func (s *CiliumV2RegisterSuite) TestFQDNNameRegex(c *C) {
 		c.Assert(patternRegex.MatchString(f), Equals, true, Commentf(f))
 	}
 }
+
+func (s *CiliumV2RegisterSuite) TestNeedsUpdatePrinterColumns(c *C) {
+	desired := s.getTestUpToDateDefinition()
+	desired.Spec.AdditionalPrinterColumns = []apiextensionsv1beta1.CustomResourceColumnDefinition{
+		{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+	}
+
+	cluster := s.getTestUpToDateDefinition()
+	cluster.Spec.AdditionalPrinterColumns = []apiextensionsv1beta1.CustomResourceColumnDefinition{
+		{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+	}
+	c.Assert(needsUpdate(desired, cluster), Equals, false)
+
+	// A changed column triggers a reconcile.
+	cluster.Spec.AdditionalPrinterColumns[0].JSONPath = ".metadata.uid"
+	c.Assert(needsUpdate(desired, cluster), Equals, true)
+
+	// A user removing the columns triggers a reconcile as well.
+	cluster.Spec.AdditionalPrinterColumns = nil
+	c.Assert(needsUpdate(desired, cluster), Equals, true)
+}
+
+func (s *CiliumV2RegisterSuite) TestValidateCRDName(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+	c.Assert(validateCRDName(crd), IsNil)
+
+	badName := crd.DeepCopy()
+	badName.Name = "somethingelse." + badName.Spec.Group
+	c.Assert(validateCRDName(badName), ErrorMatches, ".*does not match <plural>\\.<group>.*")
+
+	badChars := crd.DeepCopy()
+	badChars.Spec.Names.Plural = "Invalid_Plural"
+	badChars.Name = badChars.Spec.Names.Plural + "." + badChars.Spec.Group
+	c.Assert(validateCRDName(badChars), ErrorMatches, ".*not a valid DNS subdomain.*")
+}
+
+func (s *CiliumV2RegisterSuite) TestEnsurePreferredVersionOrder(c *C) {
+	crd := s.getTestUpToDateDefinition()
+
+	// No explicit Versions slice is left untouched.
+	c.Assert(ensurePreferredVersionOrder(crd), IsNil)
+
+	crd.Spec.Versions = []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+		{Name: "v2alpha1", Served: true},
+		{Name: "v2", Served: true, Storage: true},
+	}
+	c.Assert(ensurePreferredVersionOrder(crd), IsNil)
+	c.Assert(crd.Spec.Versions[0].Name, Equals, "v2")
+	c.Assert(crd.Spec.Versions[1].Name, Equals, "v2alpha1")
+
+	crd.Spec.Versions = []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+		{Name: "v2alpha1", Served: true, Storage: true},
+		{Name: "v2", Served: true, Storage: true},
+	}
+	c.Assert(ensurePreferredVersionOrder(crd), ErrorMatches, ".*more than one storage version.*")
+
+	crd.Spec.Versions = []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+		{Name: "v2", Served: true},
+	}
+	c.Assert(ensurePreferredVersionOrder(crd), ErrorMatches, ".*declares no storage version")
+
+	crd.Spec.Versions = []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+		{Name: "v2", Served: true, Storage: true},
+		{Name: "v2", Served: true},
+	}
+	c.Assert(ensurePreferredVersionOrder(crd), ErrorMatches, ".*declares version v2 more than once")
+}
+
+func (s *CiliumV2RegisterSuite) TestSharedCRDInformerReads(c *C) {
+	defer UseSharedCRDInformer(nil)
+
+	crd := s.mustConstructCNPCRD(c)
+
+	clusterCRD := crd.DeepCopy()
+	clusterCRD.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{
+			Type:   apiextensionsv1beta1.Established,
+			Status: apiextensionsv1beta1.ConditionTrue,
+		},
+	}
+
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	c.Assert(store.Add(clusterCRD), IsNil)
+	UseSharedCRDInformer(&SharedCRDInformer{
+		Store:     store,
+		HasSynced: func() bool { return true },
+	})
+
+	// Any direct apiserver read fails, proving that the reads are served
+	// from the shared cache.
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("get", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, goerrors.New("direct apiserver read")
+		})
+
+	c.Assert(createUpdateCRD(clientset, CNPCRDName, crd), IsNil)
+
+	// An unsynced informer falls back to direct apiserver calls.
+	UseSharedCRDInformer(&SharedCRDInformer{
+		Store:     store,
+		HasSynced: func() bool { return false },
+	})
+	c.Assert(createUpdateCRD(clientset, CNPCRDName, crd), ErrorMatches, "direct apiserver read")
+}
+
+func (s *CiliumV2RegisterSuite) TestShortNameReconciliation(c *C) {
+	desired := s.getTestUpToDateDefinition()
+	desired.Spec.Names.ShortNames = []string{"cnp", "ciliumnp"}
+
+	cluster := s.getTestUpToDateDefinition()
+	cluster.Spec.Names.ShortNames = []string{"cnp", "ciliumnp"}
+	c.Assert(needsUpdate(desired, cluster), Equals, false)
+
+	// A user-added short name alone does not trigger an update.
+	cluster.Spec.Names.ShortNames = []string{"cnp", "ciliumnp", "usershort"}
+	c.Assert(needsUpdate(desired, cluster), Equals, false)
+
+	// A missing pregenerated short name does.
+	cluster.Spec.Names.ShortNames = []string{"cnp", "usershort"}
+	c.Assert(needsUpdate(desired, cluster), Equals, true)
+
+	// Reconciling preserves the non-conflicting user-added short name.
+	c.Assert(mergeShortNames(desired.Spec.Names.ShortNames, cluster.Spec.Names.ShortNames),
+		DeepEquals, []string{"cnp", "ciliumnp", "usershort"})
+}
+
+func (s *CiliumV2RegisterSuite) TestValidatePregeneratedCRDs(c *C) {
+	c.Assert(ValidatePregeneratedCRDs(), IsNil)
+}
+
+func (s *CiliumV2RegisterSuite) TestSetIdentityCRDMode(c *C) {
+	defer func() {
+		c.Assert(SetIdentityCRDMode(IdentityCRDAuto), IsNil)
+	}()
+
+	c.Assert(SetIdentityCRDMode(IdentityCRDAlways), IsNil)
+	c.Assert(SetIdentityCRDMode(IdentityCRDNever), IsNil)
+	c.Assert(SetIdentityCRDMode("bogus"), ErrorMatches, "unknown identity CRD mode.*")
+}
+
+func (s *CiliumV2RegisterSuite) TestCreateUpdateCRDRetryOnTooManyRequests(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+
+	clusterCRD := crd.DeepCopy()
+	clusterCRD.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{
+			Type:   apiextensionsv1beta1.Established,
+			Status: apiextensionsv1beta1.ConditionTrue,
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(clusterCRD)
+
+	// Throttle the first Get with a 429 carrying a Retry-After; the
+	// operation must be retried after the suggested delay and succeed.
+	throttled := false
+	clientset.PrependReactor("get", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if throttled {
+				return false, nil, nil
+			}
+			throttled = true
+			return true, nil, errors.NewTooManyRequests("throttled by priority and fairness", 1)
+		})
+
+	c.Assert(createUpdateCRD(clientset, CNPCRDName, crd), IsNil)
+	c.Assert(throttled, Equals, true)
+}
+
+func (s *CiliumV2RegisterSuite) TestNeedsUpdatePerCRDSchemaVersion(c *C) {
+	// A CRD carrying its own schema version label is compared against
+	// that version, not the global compiled-in one.
+	desired := s.getTestUpToDateDefinition()
+	desired.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.5"
+
+	cluster := s.getTestUpToDateDefinition()
+	cluster.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.5"
+	c.Assert(needsUpdate(desired, cluster), Equals, false)
+
+	cluster.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.4"
+	c.Assert(needsUpdate(desired, cluster), Equals, true)
+}
+
+func (s *CiliumV2RegisterSuite) TestUpdateCRDAdmissionWebhookDenied(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+
+	clusterCRD := crd.DeepCopy()
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+	clusterCRD.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{
+			Type:   apiextensionsv1beta1.Established,
+			Status: apiextensionsv1beta1.ConditionTrue,
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(clusterCRD)
+	clientset.PrependReactor("update", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, &errors.StatusError{ErrStatus: metav1.Status{
+				Status:  metav1.StatusFailure,
+				Code:    400,
+				Reason:  metav1.StatusReasonBadRequest,
+				Message: `admission webhook "deny-crds.example.com" denied the request: CRD changes are frozen`,
+			}}
+		})
+
+	err := createUpdateCRD(clientset, CNPCRDName, crd)
+	c.Assert(err, NotNil)
+	c.Assert(err, ErrorMatches, `.*denied by admission webhook "deny-crds.example.com".*`)
+
+	// The denial must never trigger the self-delete path.
+	current, getErr := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(getErr, IsNil)
+	c.Assert(current.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey], Equals, "0.9")
+}
+
+func (s *CiliumV2RegisterSuite) TestCheckCRDSchemaSkew(c *C) {
+	crd := s.getTestUpToDateDefinition()
+
+	// Same version: no skew.
+	c.Assert(CheckCRDSchemaSkew(crd, s.getTestUpToDateDefinition()), IsNil)
+
+	// Older cluster version: an update case, not skew.
+	clusterCRD := s.getTestUpToDateDefinition()
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+	c.Assert(CheckCRDSchemaSkew(crd, clusterCRD), IsNil)
+
+	// Newer cluster version: skew, with both versions in the message.
+	clusterCRD = s.getTestUpToDateDefinition()
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "99.0"
+	err := CheckCRDSchemaSkew(crd, clusterCRD)
+	c.Assert(err, NotNil)
+	c.Assert(goerrors.Is(err, ErrCRDSchemaSkew), Equals, true)
+	c.Assert(err, ErrorMatches, ".*99.0.*"+ciliumv2.CustomResourceDefinitionSchemaVersion+".*")
+
+	// An unlabeled cluster CRD is handled by the unlabeled CRD policy, not
+	// reported as skew.
+	clusterCRD = s.getTestUpToDateDefinition()
+	clusterCRD.Labels = nil
+	c.Assert(CheckCRDSchemaSkew(crd, clusterCRD), IsNil)
+}
+
+func (s *CiliumV2RegisterSuite) TestNeedsUpdateDeepSchemaComparison(c *C) {
+	defer SetDeepSchemaComparison(false)
+
+	crd := s.getTestUpToDateDefinition()
+
+	// A schema edited behind Cilium's back with the version label intact.
+	clusterCRD := s.getTestUpToDateDefinition()
+	clusterCRD.Spec.Validation.OpenAPIV3Schema.Description = "manually edited"
+
+	// The label-only comparison does not see the divergence.
+	c.Assert(needsUpdate(crd, clusterCRD), Equals, false)
+
+	// The deep comparison does.
+	SetDeepSchemaComparison(true)
+	c.Assert(needsUpdate(crd, clusterCRD), Equals, true)
+	c.Assert(needsUpdate(crd, s.getTestUpToDateDefinition()), Equals, false)
+}
+
+func (s *CiliumV2RegisterSuite) TestUpdateCRDPermanentErrorFailsFast(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+
+	clusterCRD := crd.DeepCopy()
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+
+	clientset := fake.NewSimpleClientset(clusterCRD)
+
+	attempts := 0
+	clientset.PrependReactor("update", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			attempts++
+			return true, nil, errors.NewForbidden(
+				schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+				crd.Name,
+				goerrors.New("RBAC: no update permission"))
+		})
+
+	// Unlike a conflict, a permanent rejection must not be retried.
+	err := updateCRD(clientset, log, crd, false)
+	c.Assert(err, NotNil)
+	c.Assert(errors.IsForbidden(err), Equals, true)
+	c.Assert(attempts, Equals, 1)
+}
+
+func (s *CiliumV2RegisterSuite) TestReconcileCRDServerSideApply(c *C) {
+	defer func() {
+		c.Assert(k8sversion.Force("0.0.0"), IsNil)
+	}()
+	c.Assert(k8sversion.Force("1.16.0"), IsNil)
+
+	crd := s.mustConstructCNPCRD(c)
+
+	clusterCRD := crd.DeepCopy()
+	clusterCRD.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey] = "0.9"
+	clusterCRD.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{
+			Type:   apiextensionsv1beta1.Established,
+			Status: apiextensionsv1beta1.ConditionTrue,
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(clusterCRD)
+
+	// The fake object tracker does not implement the apply patch type;
+	// emulate the apiserver by updating the stored object with the
+	// applied configuration.
+	patches := 0
+	clientset.PrependReactor("patch", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			patch := action.(k8stesting.PatchAction)
+			c.Assert(patch.GetPatchType(), Equals, types.ApplyPatchType)
+			patches++
+
+			applied := apiextensionsv1beta1.CustomResourceDefinition{}
+			c.Assert(json.Unmarshal(patch.GetPatch(), &applied), IsNil)
+			applied.Status = clusterCRD.Status
+			err := clientset.Tracker().Update(
+				apiextensionsv1beta1.SchemeGroupVersion.WithResource("customresourcedefinitions"),
+				&applied, "")
+			return true, &applied, err
+		})
+
+	report, err := ReconcileCRDs(context.Background(), clientset, ReconcileOptions{
+		Filter:          []string{CNPCRDName},
+		ServerSideApply: true,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(report.Actions[ciliumv2.CNPName], Equals, "update")
+	c.Assert(patches, Equals, 1)
+
+	current, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(current.Labels[ciliumv2.CustomResourceDefinitionSchemaVersionKey],
+		Equals, ciliumv2.CustomResourceDefinitionSchemaVersion)
+}
+
+func (s *CiliumV2RegisterSuite) TestValidatePreserveUnknownFields(c *C) {
+	// The pregenerated templates leave the field unset or false, which the
+	// constructs carry over verbatim.
+	crd := s.mustConstructCNPCRD(c)
+	pregenerated, err := GetPregeneratedCRD(CNPCRDName)
+	c.Assert(err, IsNil)
+	c.Assert(crd.Spec.PreserveUnknownFields, DeepEquals, pregenerated.Spec.PreserveUnknownFields)
+	c.Assert(validatePreserveUnknownFields(crd), IsNil)
+
+	preserve := false
+	crd.Spec.PreserveUnknownFields = &preserve
+	c.Assert(validatePreserveUnknownFields(crd), IsNil)
+
+	preserve = true
+	c.Assert(validatePreserveUnknownFields(crd), ErrorMatches,
+		".*preserveUnknownFields=true, which is incompatible with structural schemas")
+}
+
+// TestNeedsUpdateEmptyVersions verifies a cluster CRD stripped of all version
+// information neither panics the comparison nor slips past validation.
+func (s *CiliumV2RegisterSuite) TestNeedsUpdateEmptyVersions(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+
+	// The constructs always emit a serving version.
+	c.Assert(crd.Spec.Version, Not(Equals), "")
+
+	clusterCRD := crd.DeepCopy()
+	clusterCRD.Spec.Version = ""
+	clusterCRD.Spec.Versions = nil
+
+	// The comparison itself must not panic on the malformed object.
+	c.Assert(needsUpdate(crd, clusterCRD), Equals, false)
+
+	// Validation rejects it with a descriptive error before any compare.
+	c.Assert(validateClusterCRD(clusterCRD), ErrorMatches,
+		".*spec contains no version information")
+}
+
+// TestRetryOnTransientError verifies transient failures on the initial Get
+// are retried while permanent rejections fail fast.
+func (s *CiliumV2RegisterSuite) TestRetryOnTransientError(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+
+	// The first Get fails with a server timeout; the retry converges.
+	clientset := s.newEstablishingClientset()
+	failures := 1
+	clientset.PrependReactor("get", "customresourcedefinitions",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if failures > 0 {
+				failures--
+				return true, nil, errors.NewServerTimeout(
+					apiextensionsv1beta1.Resource("customresourcedefinitions"), "get", 0)
+			}
+			return false, nil, nil
+		})
+
+	_, err := ReconcileCRDs(context.TODO(), clientset, ReconcileOptions{Filter: []string{CNPCRDName}})
+	c.Assert(err, IsNil)
+
+	_, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(), crd.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+
+	// A Forbidden rejection is not retried.
+	attempts := 0
+	err = retryOnTransientError(log.WithField("name", "test"), func() error {
+		attempts++
+		return errors.NewForbidden(
+			apiextensionsv1beta1.Resource("customresourcedefinitions"), crd.ObjectMeta.Name, nil)
+	})
+	c.Assert(errors.IsForbidden(err), Equals, true)
+	c.Assert(attempts, Equals, 1)
+}
+
+func (s *CiliumV2RegisterSuite) TestDiffCRDSchema(c *C) {
+	desired := s.mustConstructCNPCRD(c)
+	cluster := desired.DeepCopy()
+
+	diff, err := DiffCRDSchema(desired, cluster)
+	c.Assert(err, IsNil)
+	c.Assert(diff, Equals, "")
+
+	cluster.Spec.Validation = &apiextensionsv1beta1.CustomResourceValidation{}
+	diff, err = DiffCRDSchema(desired, cluster)
+	c.Assert(err, IsNil)
+	c.Assert(diff, Not(Equals), "")
+	c.Assert(diff, Matches, `(?s)--- cluster.*\+\+\+ desired.*`)
+}
+
+func (s *CiliumV2RegisterSuite) TestCompareCRDSchemaVersion(c *C) {
+	cmp, err := CompareCRDSchemaVersion("0.1")
+	c.Assert(err, IsNil)
+	c.Assert(cmp, Equals, -1)
+
+	cmp, err = CompareCRDSchemaVersion(ciliumv2.CustomResourceDefinitionSchemaVersion)
+	c.Assert(err, IsNil)
+	c.Assert(cmp, Equals, 0)
+
+	cmp, err = CompareCRDSchemaVersion("99.0")
+	c.Assert(err, IsNil)
+	c.Assert(cmp, Equals, 1)
+
+	_, err = CompareCRDSchemaVersion("not-a-version")
+	c.Assert(err, ErrorMatches, `unable to parse CRD schema version "not-a-version".*`)
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+
+	k8sconstv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetServedCNPSchema returns the validation schema of the CiliumNetworkPolicy
+// CRD as served by the apiserver. Unlike the pregenerated assets, the
+// returned schema includes any defaults or customizations injected into the
+// cluster CRD, which lets editors and linters validate against the schema
+// actually enforced by the cluster.
+func GetServedCNPSchema(clientset apiextensionsclient.Interface) (*apiextensionsv1beta1.JSONSchemaProps, error) {
+	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.TODO(),
+		k8sconstv2.CNPName,
+		metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// A per-version schema of a served version takes precedence over the
+	// top-level validation schema shared by all versions.
+	for _, version := range clusterCRD.Spec.Versions {
+		if version.Served && version.Schema != nil && version.Schema.OpenAPIV3Schema != nil {
+			return version.Schema.OpenAPIV3Schema, nil
+		}
+	}
+
+	if clusterCRD.Spec.Validation == nil || clusterCRD.Spec.Validation.OpenAPIV3Schema == nil {
+		return nil, fmt.Errorf("CRD %s does not serve a validation schema", k8sconstv2.CNPName)
+	}
+
+	return clusterCRD.Spec.Validation.OpenAPIV3Schema, nil
+}
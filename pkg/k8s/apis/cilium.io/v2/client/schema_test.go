@@ -0,0 +1,38 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	. "gopkg.in/check.v1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+)
+
+func (s *CiliumV2RegisterSuite) TestGetServedCNPSchema(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+	clientset := fake.NewSimpleClientset(crd)
+
+	schema, err := GetServedCNPSchema(clientset)
+	c.Assert(err, IsNil)
+	c.Assert(schema, DeepEquals, crd.Spec.Validation.OpenAPIV3Schema)
+
+	withoutValidation := crd.DeepCopy()
+	withoutValidation.Spec.Validation = nil
+	clientset = fake.NewSimpleClientset(withoutValidation)
+
+	_, err = GetServedCNPSchema(clientset)
+	c.Assert(err, ErrorMatches, ".*does not serve a validation schema")
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	ciliumscheme "github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/scheme"
+	"github.com/cilium/cilium/pkg/option"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// crdStorageVersion returns the storage version of the given cluster CRD,
+// falling back to the single Spec.Version for CRDs without an explicit
+// Versions slice.
+func crdStorageVersion(clusterCRD *apiextensionsv1beta1.CustomResourceDefinition) string {
+	for _, version := range clusterCRD.Spec.Versions {
+		if version.Storage {
+			return version.Name
+		}
+	}
+	return clusterCRD.Spec.Version
+}
+
+// CheckCRDStorageVersions verifies for each managed CRD present in the
+// cluster that its storage version is registered in the scheme of the typed
+// Cilium clientset. A CRD whose storage version is unknown to the client
+// makes reads fail cryptically once the agent lists objects, so this check
+// surfaces the compatibility gap up front. Managed CRDs not yet installed
+// are skipped.
+func CheckCRDStorageVersions(clientset apiextensionsclient.Interface) error {
+	var unknown []string
+
+	// The identity CRD is checked regardless of the runtime allocation
+	// mode; when present in the cluster its storage version must be
+	// readable either way.
+	for _, crdName := range ListCiliumCRDNames(option.IdentityAllocationModeCRD) {
+		crd, err := crdConstructFor(crdName)()
+		if err != nil {
+			return err
+		}
+
+		clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+			context.TODO(),
+			crd.ObjectMeta.Name,
+			metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		storageVersion := crdStorageVersion(clusterCRD)
+		gv := schema.GroupVersion{Group: clusterCRD.Spec.Group, Version: storageVersion}
+		if !ciliumscheme.Scheme.IsVersionRegistered(gv) {
+			unknown = append(unknown, fmt.Sprintf("%s (storage version %s)", crd.ObjectMeta.Name, gv))
+		}
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("CRDs use a storage version unknown to this client: %s",
+			strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+// StoredObjectClient is the subset of the dynamic client's ResourceInterface
+// used by MigrateStoredObjects. A dynamic resource client scoped to the CRD's
+// group/version/resource satisfies it structurally, so this package does not
+// depend on the dynamic client machinery.
+type StoredObjectClient interface {
+	List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error)
+	Update(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error)
+}
+
+// MigrateStoredObjects rewrites every object served by the given resource
+// client with a no-op update, forcing the apiserver to re-store it at the
+// current storage version. This is the standard migration dance after a CRD
+// storage version bump: objects remain stored at the old version until
+// touched, and the old version cannot be dropped from the CRD before all of
+// them are rewritten. The collection is paged with the given page size
+// (defaulting to 500 when zero) so large clusters are not listed in one
+// call. Objects which disappear or are modified concurrently during the
+// migration are skipped; any writer re-stores them anyway. Once all objects
+// are rewritten, ClearStoredVersions completes the migration.
+func MigrateStoredObjects(ctx context.Context, client StoredObjectClient, pageSize int64) error {
+	if pageSize <= 0 {
+		pageSize = 500
+	}
+
+	opts := metav1.ListOptions{Limit: pageSize}
+	for {
+		list, err := client.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		for i := range list.Items {
+			_, err := client.Update(ctx, &list.Items[i], metav1.UpdateOptions{})
+			switch {
+			case errors.IsConflict(err), errors.IsNotFound(err):
+				// Concurrently modified or deleted; either way the
+				// object is no longer stored at the old version or
+				// is gone.
+				continue
+			case err != nil:
+				return fmt.Errorf("unable to rewrite %s %s/%s: %w",
+					list.Items[i].GetKind(), list.Items[i].GetNamespace(), list.Items[i].GetName(), err)
+			}
+		}
+
+		if list.GetContinue() == "" {
+			return nil
+		}
+		opts.Continue = list.GetContinue()
+	}
+}
+
+// ClearStoredVersions trims status.storedVersions of the given CRD down to
+// its current storage version. It must only be called after
+// MigrateStoredObjects rewrote all objects of the CRD; until then the old
+// version may still back stored objects and dropping it from the list would
+// lie to the apiserver. A CRD already trimmed is left untouched.
+func ClearStoredVersions(ctx context.Context, clientset apiextensionsclient.Interface, crdName string) error {
+	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		ctx, crdName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	storageVersion := crdStorageVersion(clusterCRD)
+	if len(clusterCRD.Status.StoredVersions) == 1 &&
+		clusterCRD.Status.StoredVersions[0] == storageVersion {
+		return nil
+	}
+
+	clusterCRD.Status.StoredVersions = []string{storageVersion}
+	_, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().UpdateStatus(
+		ctx, clusterCRD, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"context"
+	"fmt"
+
+	. "gopkg.in/check.v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func (s *CiliumV2RegisterSuite) TestCheckCRDStorageVersions(c *C) {
+	// An empty cluster passes: not-yet-installed CRDs are skipped.
+	c.Assert(CheckCRDStorageVersions(fake.NewSimpleClientset()), IsNil)
+
+	// A CRD stored at the version the clientset registers passes.
+	crd := s.mustConstructCNPCRD(c)
+	c.Assert(CheckCRDStorageVersions(fake.NewSimpleClientset(crd)), IsNil)
+
+	// A CRD whose storage version the client does not know is reported.
+	crd = s.mustConstructCNPCRD(c)
+	crd.Spec.Version = ""
+	crd.Spec.Versions = []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+		{Name: "v3", Served: true, Storage: true},
+	}
+	err := CheckCRDStorageVersions(fake.NewSimpleClientset(crd))
+	c.Assert(err, NotNil)
+	c.Assert(err, ErrorMatches, ".*storage version.*v3.*")
+}
+
+// pagingObjectClient serves a fixed set of unstructured objects in pages and
+// records the names rewritten through Update.
+type pagingObjectClient struct {
+	items    []unstructured.Unstructured
+	conflict map[string]bool
+	updated  []string
+}
+
+func (p *pagingObjectClient) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	offset := 0
+	if opts.Continue != "" {
+		if _, err := fmt.Sscanf(opts.Continue, "%d", &offset); err != nil {
+			return nil, err
+		}
+	}
+
+	end := offset + int(opts.Limit)
+	if opts.Limit == 0 || end > len(p.items) {
+		end = len(p.items)
+	}
+
+	list := &unstructured.UnstructuredList{Items: p.items[offset:end]}
+	if end < len(p.items) {
+		list.SetContinue(fmt.Sprintf("%d", end))
+	}
+	return list, nil
+}
+
+func (p *pagingObjectClient) Update(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if p.conflict[obj.GetName()] {
+		return nil, errors.NewConflict(schema.GroupResource{Group: "cilium.io", Resource: "ciliumendpoints"},
+			obj.GetName(), fmt.Errorf("object was modified"))
+	}
+	p.updated = append(p.updated, obj.GetName())
+	return obj, nil
+}
+
+func (s *CiliumV2RegisterSuite) TestMigrateStoredObjects(c *C) {
+	client := &pagingObjectClient{conflict: map[string]bool{"cep-3": true}}
+	for i := 0; i < 5; i++ {
+		obj := unstructured.Unstructured{}
+		obj.SetName(fmt.Sprintf("cep-%d", i))
+		client.items = append(client.items, obj)
+	}
+
+	// All objects are rewritten across pages; the conflicting one is
+	// skipped without failing the migration.
+	c.Assert(MigrateStoredObjects(context.Background(), client, 2), IsNil)
+	c.Assert(client.updated, DeepEquals, []string{"cep-0", "cep-1", "cep-2", "cep-4"})
+}
+
+func (s *CiliumV2RegisterSuite) TestClearStoredVersions(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+	crd.Status.StoredVersions = []string{"v1", "v2"}
+	clientset := fake.NewSimpleClientset(crd)
+
+	c.Assert(ClearStoredVersions(context.Background(), clientset, crd.ObjectMeta.Name), IsNil)
+
+	current, err := getClusterCRD(clientset, crd.ObjectMeta.Name)
+	c.Assert(err, IsNil)
+	c.Assert(current.Status.StoredVersions, DeepEquals, []string{"v2"})
+
+	// Already trimmed CRDs are left untouched.
+	c.Assert(ClearStoredVersions(context.Background(), clientset, crd.ObjectMeta.Name), IsNil)
+}
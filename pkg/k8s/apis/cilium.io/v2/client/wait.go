@@ -0,0 +1,141 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// CRDWaitConfig configures WaitForCRDEstablishedCh.
+type CRDWaitConfig struct {
+	// PollInterval is the interval at which the CRD status is polled.
+	// Defaults to 500ms when zero.
+	PollInterval time.Duration
+}
+
+// WaitForCRDEstablishedCh waits in a goroutine for the named CRD to reach the
+// Established condition and delivers the final result on the returned
+// channel. This allows waiting for multiple CRDs with a select instead of
+// spawning goroutines around a blocking call. The goroutine exits and the
+// channel delivers the context error when ctx is cancelled.
+func WaitForCRDEstablishedCh(ctx context.Context, clientset apiextensionsclient.Interface,
+	crdName string, cfg CRDWaitConfig) <-chan error {
+
+	out := make(chan error, 1)
+	go func() {
+		defer close(out)
+		out <- waitForCRDEstablished(ctx, clientset, crdName, cfg)
+	}()
+	return out
+}
+
+// waitForCRDEstablished polls the named CRD until it reports the Established
+// condition, ctx is cancelled, or the names of the CRD were rejected.
+func waitForCRDEstablished(ctx context.Context, clientset apiextensionsclient.Interface,
+	crdName string, cfg CRDWaitConfig) error {
+
+	interval := cfg.PollInterval
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+
+	err := wait.PollImmediateUntil(interval, func() (bool, error) {
+		clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+			ctx,
+			crdName,
+			metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		for _, cond := range clusterCRD.Status.Conditions {
+			switch cond.Type {
+			case apiextensionsv1beta1.Established:
+				if cond.Status == apiextensionsv1beta1.ConditionTrue {
+					return true, nil
+				}
+			case apiextensionsv1beta1.NamesAccepted:
+				if cond.Status == apiextensionsv1beta1.ConditionFalse {
+					return false, fmt.Errorf("names not accepted for CRD %s: %s: %s",
+						crdName, cond.Reason, cond.Message)
+				}
+			}
+		}
+		return false, nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// WaitForCRDsEstablished blocks until every CRD with the given metadata names
+// (e.g. "ciliumnetworkpolicies.cilium.io") carries an Established condition
+// with status True, or the timeout elapses. A CRD which does not exist yet is
+// polled until it appears, since the installing agent may still be creating
+// it. Unlike the installation flow this never mutates the cluster: a CRD
+// which fails to establish in time is left in place and the timeout is
+// reported as an error. This lets controllers which depend on the Cilium
+// CRDs, but do not own them, order their startup without racing the
+// installing agent.
+func WaitForCRDsEstablished(ctx context.Context, clientset apiextensionsclient.Interface,
+	names []string, timeout time.Duration) error {
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	g, waitCtx := errgroup.WithContext(waitCtx)
+	for _, name := range names {
+		name := name
+		g.Go(func() error {
+			err := wait.PollImmediateUntil(500*time.Millisecond, func() (bool, error) {
+				clusterCRD, getErr := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+					ctx,
+					name,
+					metav1.GetOptions{})
+				if getErr != nil {
+					// Not installed yet, or a transient apiserver
+					// error; keep polling.
+					return false, nil
+				}
+
+				for _, cond := range clusterCRD.Status.Conditions {
+					if cond.Type == apiextensionsv1beta1.Established &&
+						cond.Status == apiextensionsv1beta1.ConditionTrue {
+						return true, nil
+					}
+				}
+				return false, nil
+			}, waitCtx.Done())
+			if err == wait.ErrWaitTimeout {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return ctxErr
+				}
+				return fmt.Errorf("timed out waiting for CRD %s to become established", name)
+			}
+			return err
+		})
+	}
+
+	return g.Wait()
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"context"
+	"time"
+
+	. "gopkg.in/check.v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (s *CiliumV2RegisterSuite) TestWaitForCRDEstablishedCh(c *C) {
+	crd := s.mustConstructCNPCRD(c)
+	crd.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{
+			Type:   apiextensionsv1beta1.Established,
+			Status: apiextensionsv1beta1.ConditionTrue,
+		},
+	}
+	clientset := fake.NewSimpleClientset(crd)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	select {
+	case err := <-WaitForCRDEstablishedCh(ctx, clientset, crd.ObjectMeta.Name, CRDWaitConfig{}):
+		c.Assert(err, IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for establishment result")
+	}
+}
+
+func (s *CiliumV2RegisterSuite) TestWaitForCRDEstablishedChCancelled(c *C) {
+	// The CRD never becomes established; cancelling the context must
+	// terminate the wait and deliver the context error.
+	clientset := fake.NewSimpleClientset(s.mustConstructCNPCRD(c))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := WaitForCRDEstablishedCh(ctx, clientset, s.mustConstructCNPCRD(c).ObjectMeta.Name,
+		CRDWaitConfig{PollInterval: 10 * time.Millisecond})
+	cancel()
+
+	select {
+	case err := <-ch:
+		c.Assert(err, Equals, context.Canceled)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for cancellation result")
+	}
+}
+
+// TestWaitForCRDsEstablished covers the read-only multi-CRD establishment
+// wait.
+func (s *CiliumV2RegisterSuite) TestWaitForCRDsEstablished(c *C) {
+	cnpCRD := s.mustConstructCNPCRD(c)
+	cepCRD, err := constructCEPCRD()
+	c.Assert(err, IsNil)
+
+	established := []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{
+			Type:   apiextensionsv1beta1.Established,
+			Status: apiextensionsv1beta1.ConditionTrue,
+		},
+	}
+	cnpCRD.Status.Conditions = established
+	cepCRD.Status.Conditions = established
+	clientset := fake.NewSimpleClientset(cnpCRD, cepCRD)
+
+	names := []string{cnpCRD.ObjectMeta.Name, cepCRD.ObjectMeta.Name}
+	c.Assert(WaitForCRDsEstablished(context.Background(), clientset, names, 5*time.Second), IsNil)
+
+	// A CRD which never establishes times out without being deleted.
+	stuck := fake.NewSimpleClientset(s.mustConstructCNPCRD(c))
+	err = WaitForCRDsEstablished(context.Background(), stuck,
+		[]string{cnpCRD.ObjectMeta.Name}, 100*time.Millisecond)
+	c.Assert(err, ErrorMatches, "timed out waiting for CRD .* to become established")
+
+	_, err = stuck.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		context.Background(), cnpCRD.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	rest "k8s.io/client-go/rest"
+)
+
+// crdWarningSink receives the text of every apiserver warning observed on a
+// connection configured through WithCRDWarningLogging. The default sink logs
+// at Warn level; tests substitute their own via SetCRDWarningSink.
+var crdWarningSink = logCRDWarning
+
+// logCRDWarning is the default warning sink.
+func logCRDWarning(text string) {
+	log.WithField("warning", text).Warning("Apiserver returned a warning for a CRD operation")
+}
+
+// SetCRDWarningSink overrides where apiserver warnings are delivered.
+// Passing nil reverts to logging at Warn level.
+func SetCRDWarningSink(sink func(text string)) {
+	if sink == nil {
+		sink = logCRDWarning
+	}
+	crdWarningSink = sink
+}
+
+// crdWarningHandler forwards apiserver warning headers to the registered
+// sink. It implements rest.WarningHandler.
+type crdWarningHandler struct{}
+
+func (crdWarningHandler) HandleWarningHeader(code int, agent, text string) {
+	// Per RFC 2616 only code 299 carries miscellaneous warnings; other
+	// codes are handled by the transport itself.
+	if code != 299 || text == "" {
+		return
+	}
+	crdWarningSink(text)
+}
+
+// WithCRDWarningLogging returns a copy of the given rest config which
+// surfaces apiserver warnings on CRD writes at Warn level instead of
+// discarding them. Deprecation warnings, e.g. for schema fields the next
+// Kubernetes release turns into hard errors, become visible in the agent log
+// this way. The warning header does not identify the CRD, so the log carries
+// the warning text only; correlate with the surrounding reconcile logs for
+// the CRD name. The passed config is not mutated.
+func WithCRDWarningLogging(c *rest.Config) *rest.Config {
+	config := *c
+	config.WarningHandler = crdWarningHandler{}
+	return &config
+}
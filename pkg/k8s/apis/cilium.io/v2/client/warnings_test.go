@@ -0,0 +1,47 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+// +build !privileged_tests
+
+package client
+
+import (
+	. "gopkg.in/check.v1"
+	rest "k8s.io/client-go/rest"
+)
+
+// TestCRDWarningHandler covers the warning forwarding and its injectable
+// sink.
+func (s *CiliumV2RegisterSuite) TestCRDWarningHandler(c *C) {
+	defer SetCRDWarningSink(nil)
+
+	var captured []string
+	SetCRDWarningSink(func(text string) {
+		captured = append(captured, text)
+	})
+
+	handler := crdWarningHandler{}
+	handler.HandleWarningHeader(299, "-", "field spec.foo is deprecated")
+	handler.HandleWarningHeader(299, "-", "")
+	handler.HandleWarningHeader(214, "-", "transformation applied")
+
+	c.Assert(captured, DeepEquals, []string{"field spec.foo is deprecated"})
+
+	// The helper configures a copy, leaving the original config untouched.
+	config := &rest.Config{}
+	withWarnings := WithCRDWarningLogging(config)
+	c.Assert(withWarnings.WarningHandler, NotNil)
+	c.Assert(config.WarningHandler, IsNil)
+}
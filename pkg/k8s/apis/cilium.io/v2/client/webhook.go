@@ -0,0 +1,99 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CreateCNPValidatingWebhookConfiguration ensures the given
+// ValidatingWebhookConfiguration targeting CiliumNetworkPolicies is installed
+// into the cluster, with the same idempotent create-or-update semantics as
+// the CRD installation. A caBundle already present in the cluster is
+// preserved when the desired webhook does not carry one, as the bundle is
+// typically injected by a certificate manager after installation.
+func CreateCNPValidatingWebhookConfiguration(clientset kubernetes.Interface,
+	desired *admissionregistrationv1beta1.ValidatingWebhookConfiguration) error {
+
+	scopedLog := log.WithField("name", desired.ObjectMeta.Name)
+
+	_, err := clientset.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(
+		context.TODO(),
+		desired.ObjectMeta.Name,
+		metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		scopedLog.Info("Creating ValidatingWebhookConfiguration...")
+
+		_, err = clientset.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Create(
+			context.TODO(),
+			desired,
+			metav1.CreateOptions{})
+		if err == nil {
+			return nil
+		}
+		// Another agent won the creation race, fall through to the
+		// update below to converge on the desired configuration.
+		if !errors.IsAlreadyExists(err) {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	scopedLog.Debug("Updating existing ValidatingWebhookConfiguration...")
+
+	for retry := 0; retry < maxUpdateRetries; retry++ {
+		var existing *admissionregistrationv1beta1.ValidatingWebhookConfiguration
+
+		existing, err = clientset.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(
+			context.TODO(),
+			desired.ObjectMeta.Name,
+			metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		merged := desired.DeepCopy()
+		merged.ObjectMeta.ResourceVersion = existing.ObjectMeta.ResourceVersion
+		for i := range merged.Webhooks {
+			if len(merged.Webhooks[i].ClientConfig.CABundle) != 0 {
+				continue
+			}
+			if i < len(existing.Webhooks) {
+				merged.Webhooks[i].ClientConfig.CABundle = existing.Webhooks[i].ClientConfig.CABundle
+			}
+		}
+
+		_, err = clientset.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Update(
+			context.TODO(),
+			merged,
+			metav1.UpdateOptions{})
+		if err == nil {
+			return nil
+		}
+		if !errors.IsConflict(err) {
+			return err
+		}
+
+		scopedLog.WithError(err).Debug("ValidatingWebhookConfiguration update conflicted with a concurrent writer, retrying...")
+	}
+
+	return err
+}
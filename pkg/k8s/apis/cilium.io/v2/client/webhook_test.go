@@ -0,0 +1,85 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package client
+
+import (
+	"context"
+
+	. "gopkg.in/check.v1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func (s *CiliumV2RegisterSuite) getTestWebhookConfiguration() *admissionregistrationv1beta1.ValidatingWebhookConfiguration {
+	return &admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cilium-cnp-validator",
+		},
+		Webhooks: []admissionregistrationv1beta1.ValidatingWebhook{
+			{
+				Name: "validate.cnp.cilium.io",
+				ClientConfig: admissionregistrationv1beta1.WebhookClientConfig{
+					Service: &admissionregistrationv1beta1.ServiceReference{
+						Namespace: "kube-system",
+						Name:      "cilium-operator",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *CiliumV2RegisterSuite) TestCreateCNPValidatingWebhookConfiguration(c *C) {
+	clientset := fake.NewSimpleClientset()
+	desired := s.getTestWebhookConfiguration()
+
+	c.Assert(CreateCNPValidatingWebhookConfiguration(clientset, desired), IsNil)
+
+	installed, err := clientset.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(
+		context.TODO(), desired.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(installed.Webhooks, HasLen, 1)
+
+	// A second installation must be idempotent.
+	c.Assert(CreateCNPValidatingWebhookConfiguration(clientset, desired), IsNil)
+}
+
+func (s *CiliumV2RegisterSuite) TestWebhookCABundlePreserved(c *C) {
+	existing := s.getTestWebhookConfiguration()
+	existing.Webhooks[0].ClientConfig.CABundle = []byte("injected-ca")
+	clientset := fake.NewSimpleClientset(existing)
+
+	// The desired webhook carries no caBundle; the one injected into the
+	// cluster must survive the update.
+	c.Assert(CreateCNPValidatingWebhookConfiguration(clientset, s.getTestWebhookConfiguration()), IsNil)
+
+	installed, err := clientset.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(
+		context.TODO(), existing.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(string(installed.Webhooks[0].ClientConfig.CABundle), Equals, "injected-ca")
+
+	// A desired caBundle must win over the existing one.
+	desired := s.getTestWebhookConfiguration()
+	desired.Webhooks[0].ClientConfig.CABundle = []byte("rotated-ca")
+	c.Assert(CreateCNPValidatingWebhookConfiguration(clientset, desired), IsNil)
+
+	installed, err = clientset.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(
+		context.TODO(), existing.ObjectMeta.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(string(installed.Webhooks[0].ClientConfig.CABundle), Equals, "rotated-ca")
+}
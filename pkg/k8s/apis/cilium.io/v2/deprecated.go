@@ -0,0 +1,83 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+
+	"github.com/cilium/cilium/pkg/policy/api"
+)
+
+// deprecatedCNPFields is the set of CNP rule fields scheduled for removal,
+// along with a predicate reporting whether a rule uses the field. The table
+// is maintained alongside the schema: when a field is deprecated in the CRD,
+// an entry is added here so operators can audit their policies before
+// upgrading.
+var deprecatedCNPFields = []struct {
+	// path is the field path relative to a rule, with [*] denoting any
+	// list index.
+	path string
+
+	// inUse reports whether the given rule uses the field.
+	inUse func(rule *api.Rule) bool
+}{
+	{
+		// Superseded by fromCIDRSet, which additionally supports
+		// exclusions.
+		path: "ingress[*].fromCIDR",
+		inUse: func(rule *api.Rule) bool {
+			for _, ingress := range rule.Ingress {
+				if len(ingress.FromCIDR) > 0 {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		// Superseded by toCIDRSet, which additionally supports
+		// exclusions.
+		path: "egress[*].toCIDR",
+		inUse: func(rule *api.Rule) bool {
+			for _, egress := range rule.Egress {
+				if len(egress.ToCIDR) > 0 {
+					return true
+				}
+			}
+			return false
+		},
+	},
+}
+
+// ContainsDeprecatedFields checks the given policy against the known set of
+// deprecated field paths and returns the paths in use, prefixed with the rule
+// location, e.g. "specs[0].egress[*].toCIDR". An empty result means the
+// policy uses no deprecated fields.
+func ContainsDeprecatedFields(obj *CiliumNetworkPolicy) ([]string, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("cannot check nil CiliumNetworkPolicy")
+	}
+
+	var found []string
+	forEachCNPRule(obj, func(field string, rule *api.Rule) {
+		for _, deprecated := range deprecatedCNPFields {
+			if deprecated.inUse(rule) {
+				found = append(found, field+"."+deprecated.path)
+			}
+		}
+	})
+
+	return found, nil
+}
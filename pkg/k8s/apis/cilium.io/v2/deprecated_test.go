@@ -0,0 +1,72 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package v2
+
+import (
+	"github.com/cilium/cilium/pkg/labels"
+	"github.com/cilium/cilium/pkg/policy/api"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *CiliumV2Suite) TestContainsDeprecatedFields(c *C) {
+	_, err := ContainsDeprecatedFields(nil)
+	c.Assert(err, NotNil)
+
+	selector := api.NewESFromLabels(labels.ParseSelectLabel("role=backend"))
+
+	// A policy using only current fields reports nothing.
+	found, err := ContainsDeprecatedFields(&CiliumNetworkPolicy{
+		Spec: &api.Rule{
+			EndpointSelector: selector,
+			Egress: []api.EgressRule{
+				{
+					ToCIDRSet: []api.CIDRRule{{Cidr: "10.0.0.0/8"}},
+				},
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(found, HasLen, 0)
+
+	// Deprecated CIDR fields are reported with their rule location.
+	found, err = ContainsDeprecatedFields(&CiliumNetworkPolicy{
+		Specs: api.Rules{
+			{
+				EndpointSelector: selector,
+				Ingress: []api.IngressRule{
+					{
+						FromCIDR: []api.CIDR{"192.168.0.0/16"},
+					},
+				},
+			},
+			{
+				EndpointSelector: selector,
+				Egress: []api.EgressRule{
+					{
+						ToCIDR: []api.CIDR{"10.0.0.0/8"},
+					},
+				},
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(found, DeepEquals, []string{
+		"specs[0].ingress[*].fromCIDR",
+		"specs[1].egress[*].toCIDR",
+	})
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/cilium/cilium/pkg/policy/api"
+)
+
+// LintSeverity classifies a lint issue as a hard error or an advisory
+// warning.
+type LintSeverity string
+
+const (
+	// LintError marks an issue which makes the policy ineffective or
+	// nonsensical and should block applying it.
+	LintError LintSeverity = "error"
+
+	// LintWarning marks an issue which is likely a mistake but may be
+	// intentional, e.g. a default-deny rule without any peers.
+	LintWarning LintSeverity = "warning"
+)
+
+// LintIssue is a single semantic finding produced by LintCNP, pointing at the
+// offending field of the policy.
+type LintIssue struct {
+	// Severity classifies the issue.
+	Severity LintSeverity
+
+	// Field is the JSON path of the offending field, e.g. "specs[0].ingress[1]".
+	Field string
+
+	// Message describes the issue in human-readable form.
+	Message string
+}
+
+// CNPLintRule is a single semantic check run by LintCNP over a parsed
+// CiliumNetworkPolicy.
+type CNPLintRule func(cnp *CiliumNetworkPolicy) []LintIssue
+
+// cnpLintRules is the set of semantic checks run by LintCNP. It covers
+// logical mistakes which pass schema validation, e.g. rules that match
+// nothing.
+var cnpLintRules = []CNPLintRule{
+	lintCNPHasRules,
+	lintCNPRuleSelectors,
+	lintCNPEmptyRules,
+}
+
+// RegisterCNPLintRule adds a semantic check to the rule set run by LintCNP.
+// This allows tooling to layer organization-specific policy conventions on
+// top of the built-in checks.
+func RegisterCNPLintRule(rule CNPLintRule) {
+	cnpLintRules = append(cnpLintRules, rule)
+}
+
+// LintCNP runs the registered semantic checks over the given policy and
+// returns the issues found. An empty result means the policy passed all
+// checks; schema validation is out of scope and expected to have happened
+// before linting.
+func LintCNP(cnp *CiliumNetworkPolicy) []LintIssue {
+	var issues []LintIssue
+	for _, rule := range cnpLintRules {
+		issues = append(issues, rule(cnp)...)
+	}
+	return issues
+}
+
+// forEachCNPRule invokes fn for every rule of the policy, regardless of
+// whether it is carried in Spec or Specs, along with the JSON path of the
+// rule.
+func forEachCNPRule(cnp *CiliumNetworkPolicy, fn func(field string, rule *api.Rule)) {
+	if cnp.Spec != nil {
+		fn("spec", cnp.Spec)
+	}
+	for i, rule := range cnp.Specs {
+		if rule != nil {
+			fn(fmt.Sprintf("specs[%d]", i), rule)
+		}
+	}
+}
+
+// lintCNPHasRules flags a policy which carries neither a Spec nor any Specs
+// and therefore has no effect at all.
+func lintCNPHasRules(cnp *CiliumNetworkPolicy) []LintIssue {
+	if cnp.Spec == nil && len(cnp.Specs) == 0 {
+		return []LintIssue{{
+			Severity: LintError,
+			Field:    "spec",
+			Message:  "policy contains no rules",
+		}}
+	}
+	return nil
+}
+
+// lintCNPRuleSelectors flags rules which select no endpoints because both the
+// endpoint selector and the node selector are empty.
+func lintCNPRuleSelectors(cnp *CiliumNetworkPolicy) []LintIssue {
+	var issues []LintIssue
+	forEachCNPRule(cnp, func(field string, rule *api.Rule) {
+		if rule.EndpointSelector.LabelSelector == nil && rule.NodeSelector.LabelSelector == nil {
+			issues = append(issues, LintIssue{
+				Severity: LintError,
+				Field:    field + ".endpointSelector",
+				Message:  "rule selects nothing: endpointSelector and nodeSelector are both empty",
+			})
+		}
+	})
+	return issues
+}
+
+// lintCNPEmptyRules flags rules and rule sections which are syntactically
+// valid but likely not what the author intended: a rule without any ingress
+// or egress section only establishes default-deny, and an empty ingress or
+// egress element allows all traffic in that direction.
+func lintCNPEmptyRules(cnp *CiliumNetworkPolicy) []LintIssue {
+	var issues []LintIssue
+	forEachCNPRule(cnp, func(field string, rule *api.Rule) {
+		if len(rule.Ingress) == 0 && len(rule.Egress) == 0 {
+			issues = append(issues, LintIssue{
+				Severity: LintWarning,
+				Field:    field,
+				Message:  "rule has no ingress or egress sections and only establishes default-deny",
+			})
+			return
+		}
+
+		for i, ingress := range rule.Ingress {
+			if reflect.DeepEqual(ingress, api.IngressRule{}) {
+				issues = append(issues, LintIssue{
+					Severity: LintWarning,
+					Field:    fmt.Sprintf("%s.ingress[%d]", field, i),
+					Message:  "empty ingress rule allows all incoming traffic",
+				})
+			}
+		}
+		for i, egress := range rule.Egress {
+			if reflect.DeepEqual(egress, api.EgressRule{}) {
+				issues = append(issues, LintIssue{
+					Severity: LintWarning,
+					Field:    fmt.Sprintf("%s.egress[%d]", field, i),
+					Message:  "empty egress rule allows all outgoing traffic",
+				})
+			}
+		}
+	})
+	return issues
+}
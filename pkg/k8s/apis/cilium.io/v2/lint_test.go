@@ -0,0 +1,103 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package v2
+
+import (
+	"github.com/cilium/cilium/pkg/labels"
+	"github.com/cilium/cilium/pkg/policy/api"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *CiliumV2Suite) TestLintCNPEmptyPolicy(c *C) {
+	issues := LintCNP(&CiliumNetworkPolicy{})
+	c.Assert(issues, HasLen, 1)
+	c.Assert(issues[0].Severity, Equals, LintError)
+	c.Assert(issues[0].Field, Equals, "spec")
+}
+
+func (s *CiliumV2Suite) TestLintCNPEmptySelector(c *C) {
+	cnp := &CiliumNetworkPolicy{
+		Specs: api.Rules{
+			{
+				Ingress: []api.IngressRule{
+					{
+						FromEndpoints: []api.EndpointSelector{
+							api.NewESFromLabels(labels.ParseSelectLabel("role=frontend")),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	issues := LintCNP(cnp)
+	c.Assert(issues, HasLen, 1)
+	c.Assert(issues[0].Severity, Equals, LintError)
+	c.Assert(issues[0].Field, Equals, "specs[0].endpointSelector")
+}
+
+func (s *CiliumV2Suite) TestLintCNPEmptyRules(c *C) {
+	selector := api.NewESFromLabels(labels.ParseSelectLabel("role=backend"))
+
+	// A rule without any section is a default-deny warning.
+	cnp := &CiliumNetworkPolicy{
+		Spec: &api.Rule{EndpointSelector: selector},
+	}
+	issues := LintCNP(cnp)
+	c.Assert(issues, HasLen, 1)
+	c.Assert(issues[0].Severity, Equals, LintWarning)
+	c.Assert(issues[0].Field, Equals, "spec")
+
+	// An empty ingress element is an allow-all warning.
+	cnp = &CiliumNetworkPolicy{
+		Spec: &api.Rule{
+			EndpointSelector: selector,
+			Ingress:          []api.IngressRule{{}},
+		},
+	}
+	issues = LintCNP(cnp)
+	c.Assert(issues, HasLen, 1)
+	c.Assert(issues[0].Severity, Equals, LintWarning)
+	c.Assert(issues[0].Field, Equals, "spec.ingress[0]")
+}
+
+func (s *CiliumV2Suite) TestRegisterCNPLintRule(c *C) {
+	numBuiltin := len(cnpLintRules)
+	defer func() { cnpLintRules = cnpLintRules[:numBuiltin] }()
+
+	RegisterCNPLintRule(func(cnp *CiliumNetworkPolicy) []LintIssue {
+		return []LintIssue{{Severity: LintWarning, Field: "metadata.name", Message: "custom"}}
+	})
+
+	cnp := &CiliumNetworkPolicy{
+		Spec: &api.Rule{
+			EndpointSelector: api.NewESFromLabels(labels.ParseSelectLabel("any")),
+			Egress: []api.EgressRule{
+				{
+					ToEndpoints: []api.EndpointSelector{
+						api.NewESFromLabels(labels.ParseSelectLabel("role=db")),
+					},
+				},
+			},
+		},
+	}
+
+	issues := LintCNP(cnp)
+	c.Assert(issues, HasLen, 1)
+	c.Assert(issues[0].Message, Equals, "custom")
+}
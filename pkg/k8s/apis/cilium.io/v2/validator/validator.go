@@ -41,9 +41,11 @@ func NewNPValidator() (*NPValidator, error) {
 	// There are some default variables set by the CustomResourceValidation
 	// Marshaller so we need to marshal and unmarshal the CNPCRV to have those
 	// default values, the same way k8s api-server has it.
-	cnpCRVJSONBytes, err := json.Marshal(
-		client.GetPregeneratedCRD(client.CNPCRDName).Spec.Validation,
-	)
+	cnpCRD, err := client.GetPregeneratedCRD(client.CNPCRDName)
+	if err != nil {
+		return nil, err
+	}
+	cnpCRVJSONBytes, err := json.Marshal(cnpCRD.Spec.Validation)
 	if err != nil {
 		return nil, fmt.Errorf("BUG: unable to marshall CNPCRV: %w", err)
 	}
@@ -70,9 +72,11 @@ func NewNPValidator() (*NPValidator, error) {
 	// There are some default variables set by the CustomResourceValidation
 	// Marshaller so we need to marshal and unmarshal the CCNPCRV to have those
 	// default values, the same way k8s api-server has it.
-	ccnpCRVJSONBytes, err := json.Marshal(
-		client.GetPregeneratedCRD(client.CCNPCRDName).Spec.Validation,
-	)
+	ccnpCRD, err := client.GetPregeneratedCRD(client.CCNPCRDName)
+	if err != nil {
+		return nil, err
+	}
+	ccnpCRVJSONBytes, err := json.Marshal(ccnpCRD.Spec.Validation)
 	if err != nil {
 		return nil, fmt.Errorf("BUG: unable to marshall CCNPCRV: %w", err)
 	}
@@ -31,6 +31,7 @@ import (
 	"github.com/cilium/cilium/pkg/option"
 	"github.com/cilium/cilium/pkg/version"
 
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -263,3 +264,44 @@ func createDefaultCiliumClient() (func(), error) {
 
 	return closeAllConns, nil
 }
+
+// Clients bundles the typed clients which are built from a single rest
+// configuration. It reduces boilerplate for tools and operators which need to
+// manage the Cilium CRDs and manipulate the custom resources at the same
+// time.
+type Clients struct {
+	// KubeClient is the client for core Kubernetes resources.
+	KubeClient kubernetes.Interface
+
+	// CiliumClient is the clientset for cilium.io resources.
+	CiliumClient clientset.Interface
+
+	// APIExtClient is the clientset used to manage the Cilium CRDs.
+	APIExtClient apiextensionsclient.Interface
+}
+
+// NewClients creates all typed clients from the given rest configuration.
+// Each clientset applies its own configuration defaults to a copy of the
+// given configuration.
+func NewClients(c *rest.Config) (*Clients, error) {
+	kubeClient, err := kubernetes.NewForConfig(c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create k8s client: %s", err)
+	}
+
+	ciliumClient, err := clientset.NewForConfig(c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cilium k8s client: %s", err)
+	}
+
+	apiextClient, err := apiextensionsclient.NewForConfig(c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create k8s apiextensions client: %s", err)
+	}
+
+	return &Clients{
+		KubeClient:   kubeClient,
+		CiliumClient: ciliumClient,
+		APIExtClient: apiextClient,
+	}, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	rest "k8s.io/client-go/rest"
+
+	ciliumv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	"github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/scheme"
+)
+
+// NewForConfigWithRateLimit creates a new CiliumV2Client for the given config
+// with the client-side rate limit overridden. High-volume controllers
+// reconciling many Cilium resources would otherwise inherit the client-go
+// defaults of 5 QPS with a burst of 10, which throttles them long before the
+// apiserver does. A zero qps or burst keeps the corresponding value already
+// set on the config, which in turn falls back to the client-go default when
+// unset. The passed config is not mutated.
+func NewForConfigWithRateLimit(c *rest.Config, qps float32, burst int) (*CiliumV2Client, error) {
+	config := *c
+	if qps != 0 {
+		config.QPS = qps
+	}
+	if burst != 0 {
+		config.Burst = burst
+	}
+	return NewForConfig(&config)
+}
+
+// NewForConfigWithContentType creates a new CiliumV2Client negotiating the
+// given wire content types. Custom resources are served by the apiserver as
+// JSON (or YAML) only, so requesting application/vnd.kubernetes.protobuf as
+// the sole content type will fail at request time; the knob exists so that
+// acceptContentTypes can list protobuf before JSON for experimentation, with
+// the apiserver falling back to JSON for the Cilium CRDs. Empty strings keep
+// the values already set on the config, which default to JSON. The passed
+// config is not mutated.
+func NewForConfigWithContentType(c *rest.Config, contentType, acceptContentTypes string) (*CiliumV2Client, error) {
+	config := *c
+	if contentType != "" {
+		config.ContentType = contentType
+	}
+	if acceptContentTypes != "" {
+		config.AcceptContentTypes = acceptContentTypes
+	}
+	return NewForConfig(&config)
+}
+
+// NewForConfigAndClient creates a new CiliumV2Client which reuses the
+// transport of the given HTTP client. Applications creating several typed
+// clients (core, Cilium, apiextensions) against the same apiserver otherwise
+// end up with one TCP connection pool per client, wasting file descriptors
+// and TLS handshakes. The TLS settings must already be baked into the
+// client's transport; any TLS fields on the config are ignored since a
+// custom transport and client-side TLS configuration are mutually exclusive.
+// The passed config is not mutated.
+func NewForConfigAndClient(c *rest.Config, h *http.Client) (*CiliumV2Client, error) {
+	config := *c
+	config.Transport = h.Transport
+	config.TLSClientConfig = rest.TLSClientConfig{}
+	if h.Timeout > 0 {
+		config.Timeout = h.Timeout
+	}
+	return NewForConfig(&config)
+}
+
+// NewForConfigWithTimeout creates a new CiliumV2Client with a client-side
+// request timeout. Without one, a hung apiserver connection blocks a request
+// forever when the caller did not set a context deadline; the timeout is a
+// transport-level backstop for such call sites. A zero timeout keeps the
+// value already set on the config, which defaults to no timeout. The passed
+// config is not mutated.
+func NewForConfigWithTimeout(c *rest.Config, timeout time.Duration) (*CiliumV2Client, error) {
+	config := *c
+	if timeout > 0 {
+		config.Timeout = timeout
+	}
+	return NewForConfig(&config)
+}
+
+// NewForConfigWithUserAgent creates a new CiliumV2Client identifying itself
+// with the given user agent, e.g. "cilium-operator/crd-installer". Distinct
+// agents make apiserver audit logs and priority-and-fairness attribution
+// actionable, where the generic default would lump all components together.
+// An empty userAgent keeps the value already set on the config, which in turn
+// falls back to the client-go default when unset. The passed config is not
+// mutated.
+func NewForConfigWithUserAgent(c *rest.Config, userAgent string) (*CiliumV2Client, error) {
+	config := *c
+	if userAgent != "" {
+		config.UserAgent = userAgent
+	}
+	return NewForConfig(&config)
+}
+
+// validateClientScheme verifies the given scheme registers the Cilium v2
+// types. The generated setConfigDefaults wires scheme.Codecs into the REST
+// client unconditionally; with an empty or partially registered scheme the
+// misconfiguration only surfaces at request time as a cryptic codec error.
+// Checking up front turns that into a descriptive constructor error.
+func validateClientScheme(s *runtime.Scheme) error {
+	gv := ciliumv2.SchemeGroupVersion
+	if !s.IsVersionRegistered(gv) {
+		return fmt.Errorf("scheme does not register the %s types: was %s dropped from the scheme registration?",
+			gv, "cilium.io/v2 AddToScheme")
+	}
+	if !s.Recognizes(gv.WithKind("CiliumNetworkPolicy")) {
+		return fmt.Errorf("scheme registers %s but not its kinds: the %s types were registered incompletely",
+			gv, gv)
+	}
+	return nil
+}
+
+// NewValidatedForConfig creates a new CiliumV2Client for the given config
+// after verifying the clientset scheme actually registers the Cilium v2
+// types. It behaves like NewForConfig otherwise. Constructing the client via
+// this function is recommended for long-running components, where a broken
+// scheme registration, e.g. after an import reshuffle dropping the package
+// init, should fail startup instead of every later request.
+func NewValidatedForConfig(c *rest.Config) (*CiliumV2Client, error) {
+	if err := validateClientScheme(scheme.Scheme); err != nil {
+		return nil, fmt.Errorf("unable to create CiliumV2 client: %w", err)
+	}
+	return NewForConfig(c)
+}
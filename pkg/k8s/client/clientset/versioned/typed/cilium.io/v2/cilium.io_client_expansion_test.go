@@ -0,0 +1,82 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package v2
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	rest "k8s.io/client-go/rest"
+
+	"github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/scheme"
+)
+
+func TestSetConfigDefaultsRespectsUserAgent(t *testing.T) {
+	config := rest.Config{UserAgent: "cilium-operator/crd-installer"}
+	if err := setConfigDefaults(&config); err != nil {
+		t.Fatal(err)
+	}
+	if config.UserAgent != "cilium-operator/crd-installer" {
+		t.Fatalf("user agent was clobbered: %q", config.UserAgent)
+	}
+
+	config = rest.Config{}
+	if err := setConfigDefaults(&config); err != nil {
+		t.Fatal(err)
+	}
+	if config.UserAgent != rest.DefaultKubernetesUserAgent() {
+		t.Fatalf("expected default user agent, got %q", config.UserAgent)
+	}
+}
+
+func TestNewForConfigWithUserAgent(t *testing.T) {
+	original := rest.Config{Host: "https://localhost:6443"}
+	if _, err := NewForConfigWithUserAgent(&original, "cilium-agent/crd-installer"); err != nil {
+		t.Fatal(err)
+	}
+	if original.UserAgent != "" {
+		t.Fatalf("passed config was mutated: %q", original.UserAgent)
+	}
+}
+
+func TestValidateClientScheme(t *testing.T) {
+	// The clientset scheme registers the Cilium v2 types via its init.
+	if err := validateClientScheme(scheme.Scheme); err != nil {
+		t.Fatalf("clientset scheme failed validation: %v", err)
+	}
+
+	// An empty scheme is rejected with a descriptive error instead of
+	// failing later at request time.
+	err := validateClientScheme(runtime.NewScheme())
+	if err == nil {
+		t.Fatal("expected an error for an empty scheme")
+	}
+	if !strings.Contains(err.Error(), "cilium.io/v2") {
+		t.Fatalf("error does not name the missing group version: %v", err)
+	}
+}
+
+func TestNewValidatedForConfig(t *testing.T) {
+	client, err := NewValidatedForConfig(&rest.Config{Host: "https://localhost:6443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.RESTClient() == nil {
+		t.Fatal("expected a usable REST client")
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+
+	v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CEPLister is the subset of CiliumEndpointInterface used by
+// ListAllCiliumEndpoints to page through endpoints.
+type CEPLister interface {
+	List(ctx context.Context, opts metav1.ListOptions) (*v2.CiliumEndpointList, error)
+}
+
+// ListAllCiliumEndpoints pages through all CiliumEndpoints of the given
+// client using Continue tokens and invokes fn once per page. In large
+// clusters a single List returns tens of thousands of endpoints, risking
+// both client OOM and apiserver timeouts; paging lets garbage collectors
+// process them incrementally with bounded memory. Each delivered list
+// carries the apiserver's Continue token and RemainingItemCount untouched,
+// so fn can report progress. Iteration stops at the first error, either from
+// the apiserver or from fn.
+func ListAllCiliumEndpoints(ctx context.Context, client CEPLister, pageSize int64,
+	fn func(*v2.CiliumEndpointList) error) error {
+
+	opts := metav1.ListOptions{Limit: pageSize}
+	for {
+		list, err := client.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(list); err != nil {
+			return err
+		}
+
+		if list.Continue == "" {
+			return nil
+		}
+		opts.Continue = list.Continue
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pagingCEPLister serves a fixed set of endpoints in pages, emulating the
+// apiserver's Continue token protocol.
+type pagingCEPLister struct {
+	items []v2.CiliumEndpoint
+}
+
+func (p pagingCEPLister) List(ctx context.Context, opts metav1.ListOptions) (*v2.CiliumEndpointList, error) {
+	offset := 0
+	if opts.Continue != "" {
+		if _, err := fmt.Sscanf(opts.Continue, "%d", &offset); err != nil {
+			return nil, err
+		}
+	}
+
+	end := offset + int(opts.Limit)
+	if opts.Limit == 0 || end > len(p.items) {
+		end = len(p.items)
+	}
+
+	list := &v2.CiliumEndpointList{Items: p.items[offset:end]}
+	if end < len(p.items) {
+		list.Continue = fmt.Sprintf("%d", end)
+		remaining := int64(len(p.items) - end)
+		list.RemainingItemCount = &remaining
+	}
+	return list, nil
+}
+
+func TestListAllCiliumEndpoints(t *testing.T) {
+	lister := pagingCEPLister{items: make([]v2.CiliumEndpoint, 5)}
+
+	pages := 0
+	total := 0
+	err := ListAllCiliumEndpoints(context.Background(), lister, 2,
+		func(list *v2.CiliumEndpointList) error {
+			pages++
+			total += len(list.Items)
+			if list.Continue != "" && list.RemainingItemCount == nil {
+				t.Fatal("remaining item count missing on a partial page")
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages != 3 || total != 5 {
+		t.Fatalf("expected 5 items over 3 pages, got %d over %d", total, pages)
+	}
+
+	// An error from fn stops the iteration.
+	calls := 0
+	err = ListAllCiliumEndpoints(context.Background(), lister, 2,
+		func(list *v2.CiliumEndpointList) error {
+			calls++
+			return fmt.Errorf("stop")
+		})
+	if err == nil || calls != 1 {
+		t.Fatalf("expected iteration to stop after the first page, calls=%d err=%v", calls, err)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"time"
+
+	v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// The CiliumNetworkPolicyExpansion interface allows manually adding extra
+// methods to the CiliumNetworkPolicyInterface.
+type CiliumNetworkPolicyExpansion interface {
+	ListUnenforced(ctx context.Context) ([]*v2.CiliumNetworkPolicy, error)
+	WatchCNPToHandler(ctx context.Context, handler CNPEventHandler) error
+}
+
+// CNPEvent is a single CiliumNetworkPolicy change delivered to a
+// CNPEventHandler.
+type CNPEvent struct {
+	// Type is the kind of change: Added, Modified or Deleted. Objects
+	// delivered from the initial list are reported as Added.
+	Type watch.EventType
+
+	// CNP is the policy the event refers to.
+	CNP *v2.CiliumNetworkPolicy
+}
+
+// CNPEventHandler consumes CNP events. It is invoked synchronously per
+// event, so a slow handler naturally applies backpressure to the watch
+// consumption.
+type CNPEventHandler func(event CNPEvent)
+
+// CNPListWatcher is the subset of CiliumNetworkPolicyInterface used by
+// WatchCNPToHandler to stream events.
+type CNPListWatcher interface {
+	List(ctx context.Context, opts metav1.ListOptions) (*v2.CiliumNetworkPolicyList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// WatchCNPToHandler lists the CiliumNetworkPolicies of the given client,
+// delivers them to the handler as Added events and then streams subsequent
+// changes to the handler, one event at a time. The watch is relisted and
+// reconnected transparently when it drops, so callers get event processing
+// with bounded memory without managing the watch lifecycle themselves. It
+// returns once ctx is cancelled.
+func WatchCNPToHandler(ctx context.Context, client CNPListWatcher, handler CNPEventHandler) error {
+	for {
+		list, err := client.List(ctx, metav1.ListOptions{})
+		if err != nil {
+			if waitOrDone(ctx) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		for i := range list.Items {
+			handler(CNPEvent{Type: watch.Added, CNP: &list.Items[i]})
+		}
+
+		watcher, err := client.Watch(ctx, metav1.ListOptions{ResourceVersion: list.ResourceVersion})
+		if err != nil {
+			if waitOrDone(ctx) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		consumeCNPWatch(ctx, watcher, handler)
+		watcher.Stop()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// consumeCNPWatch delivers events from the watcher to the handler until the
+// watch channel closes or ctx is cancelled.
+func consumeCNPWatch(ctx context.Context, watcher watch.Interface, handler CNPEventHandler) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			if cnp, ok := event.Object.(*v2.CiliumNetworkPolicy); ok {
+				handler(CNPEvent{Type: event.Type, CNP: cnp})
+			}
+		}
+	}
+}
+
+// waitOrDone sleeps briefly before a list/watch retry and reports whether
+// ctx was cancelled while waiting.
+func waitOrDone(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+// WatchCNPToHandler streams the CiliumNetworkPolicies of the namespace to
+// the handler, invoking it synchronously per event.
+func (c *ciliumNetworkPolicies) WatchCNPToHandler(ctx context.Context, handler CNPEventHandler) error {
+	return WatchCNPToHandler(ctx, c, handler)
+}
+
+// IsCNPEnforced interprets the status of the given CiliumNetworkPolicy and
+// returns true if at least one node has reported status for the policy and
+// every reporting node has both accepted and enforced it.
+func IsCNPEnforced(cnp *v2.CiliumNetworkPolicy) bool {
+	if len(cnp.Status.Nodes) == 0 {
+		return false
+	}
+	for _, nodeStatus := range cnp.Status.Nodes {
+		if !nodeStatus.OK || !nodeStatus.Enforcing {
+			return false
+		}
+	}
+	return true
+}
+
+// ListUnenforced lists the CiliumNetworkPolicies in the namespace whose
+// status indicates they are not in an enforced state, e.g. due to errors or
+// nodes which have not realized the policy yet.
+func (c *ciliumNetworkPolicies) ListUnenforced(ctx context.Context) ([]*v2.CiliumNetworkPolicy, error) {
+	list, err := c.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var unenforced []*v2.CiliumNetworkPolicy
+	for i := range list.Items {
+		if cnp := &list.Items[i]; !IsCNPEnforced(cnp) {
+			unenforced = append(unenforced, cnp)
+		}
+	}
+
+	return unenforced, nil
+}
+
+// MutateCNP returns a deep copy of in with fn applied to it. Controllers
+// which read a CiliumNetworkPolicy from a shared informer cache must not
+// mutate the cached object in place; this helper makes it impossible to
+// forget the DeepCopy before an Update.
+func MutateCNP(in *v2.CiliumNetworkPolicy, fn func(*v2.CiliumNetworkPolicy)) *v2.CiliumNetworkPolicy {
+	out := in.DeepCopy()
+	fn(out)
+	return out
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+
+	v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	cilium_v2 "github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/typed/cilium.io/v2"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ListUnenforced lists the CiliumNetworkPolicies in the namespace whose
+// status indicates they are not in an enforced state.
+func (c *FakeCiliumNetworkPolicies) ListUnenforced(ctx context.Context) ([]*v2.CiliumNetworkPolicy, error) {
+	list, err := c.List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var unenforced []*v2.CiliumNetworkPolicy
+	for i := range list.Items {
+		if cnp := &list.Items[i]; !cilium_v2.IsCNPEnforced(cnp) {
+			unenforced = append(unenforced, cnp)
+		}
+	}
+
+	return unenforced, nil
+}
+
+// WatchCNPToHandler streams the CiliumNetworkPolicies of the namespace to
+// the handler, invoking it synchronously per event.
+func (c *FakeCiliumNetworkPolicies) WatchCNPToHandler(ctx context.Context, handler cilium_v2.CNPEventHandler) error {
+	return cilium_v2.WatchCNPToHandler(ctx, c, handler)
+}
@@ -22,6 +22,4 @@ type CiliumEndpointExpansion interface{}
 
 type CiliumIdentityExpansion interface{}
 
-type CiliumNetworkPolicyExpansion interface{}
-
 type CiliumNodeExpansion interface{}
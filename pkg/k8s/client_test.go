@@ -38,6 +38,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/testing"
 )
 
@@ -340,3 +341,11 @@ func (s *K8sSuite) Test_runHeartbeat(c *C) {
 		5*time.Second)
 	c.Assert(err, IsNil, Commentf("Heartbeat should have closed all connections"))
 }
+
+func (s *K8sSuite) TestNewClients(c *C) {
+	clients, err := NewClients(&rest.Config{Host: "http://127.0.0.1:8080"})
+	c.Assert(err, IsNil)
+	c.Assert(clients.KubeClient, NotNil)
+	c.Assert(clients.CiliumClient, NotNil)
+	c.Assert(clients.APIExtClient, NotNil)
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/cilium/cilium/pkg/backoff"
 	cilium_v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
 	clientset "github.com/cilium/cilium/pkg/k8s/client/clientset/versioned"
+	ciliumv2client "github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/typed/cilium.io/v2"
 	"github.com/cilium/cilium/pkg/k8s/types"
 	k8sUtils "github.com/cilium/cilium/pkg/k8s/utils"
 	k8sversion "github.com/cilium/cilium/pkg/k8s/version"
@@ -628,3 +629,42 @@ func updateStatusesByCapabilities(client clientset.Interface, capabilities k8sve
 	}
 	return nil
 }
+
+// WaitForCNPEnforcedConfig is the configuration for WaitForCNPEnforced.
+type WaitForCNPEnforcedConfig struct {
+	// CiliumNPClient is the typed client used to poll the status of the
+	// CiliumNetworkPolicy.
+	CiliumNPClient clientset.Interface
+
+	// PollInterval is the interval between two status polls. It defaults
+	// to one second when unset.
+	PollInterval time.Duration
+}
+
+// WaitForCNPEnforced polls the status of the given CiliumNetworkPolicy until
+// every node that has reported status is enforcing the policy. It returns nil
+// once the policy is enforced and an error if the policy cannot be retrieved
+// or the context is cancelled before enforcement is reported. It gives
+// controllers and test harnesses a reliable signal that a policy took effect.
+func WaitForCNPEnforced(ctx context.Context, namespace, name string, cfg WaitForCNPEnforcedConfig) error {
+	interval := cfg.PollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	for {
+		cnp, err := cfg.CiliumNPClient.CiliumV2().CiliumNetworkPolicies(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if ciliumv2client.IsCNPEnforced(cnp) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for CiliumNetworkPolicy %s/%s to be enforced: %w", namespace, name, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
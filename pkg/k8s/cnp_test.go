@@ -32,6 +32,7 @@ import (
 	cilium_v2_client "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2/client"
 	clientset "github.com/cilium/cilium/pkg/k8s/client/clientset/versioned"
 	"github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/fake"
+	typed_v2 "github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/typed/cilium.io/v2"
 	informer "github.com/cilium/cilium/pkg/k8s/client/informers/externalversions"
 	k8sconfig "github.com/cilium/cilium/pkg/k8s/config"
 	slim_metav1 "github.com/cilium/cilium/pkg/k8s/slim/k8s/apis/meta/v1"
@@ -46,6 +47,7 @@ import (
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
@@ -72,7 +74,7 @@ func (k *K8sIntegrationSuite) SetUpSuite(c *C) {
 		c.Assert(err, IsNil)
 		apiextensionsclientset, err := apiextensionsclient.NewForConfig(restConfig)
 		c.Assert(err, IsNil)
-		err = cilium_v2_client.CreateCustomResourceDefinitions(apiextensionsclientset)
+		err = cilium_v2_client.CreateCustomResourceDefinitions(context.TODO(), apiextensionsclientset)
 		c.Assert(err, IsNil)
 
 		client, err := clientset.NewForConfig(restConfig)
@@ -726,3 +728,122 @@ func (k *K8sIntegrationSuite) Benchmark_GetNodesJSON(c *C) {
 	c.Logf("Running with %d parallel clients and %d nodes", nClients, nCycles)
 	k.benchmarkGetNodes(os.Getenv("INTEGRATION") != "", nCycles, nClients, false, c)
 }
+
+func (k *K8sIntegrationSuite) TestWaitForCNPEnforced(c *C) {
+	cnp := &v2.CiliumNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testing-policy",
+			Namespace: "default",
+		},
+		Status: v2.CiliumNetworkPolicyStatus{
+			Nodes: map[string]v2.CiliumNetworkPolicyNodeStatus{
+				"node1": {OK: true, Enforcing: false},
+			},
+		},
+	}
+	ciliumNPClient := fake.NewSimpleClientset(cnp)
+	cfg := WaitForCNPEnforcedConfig{
+		CiliumNPClient: ciliumNPClient,
+		PollInterval:   time.Millisecond,
+	}
+
+	// The policy is not enforced on node1, so waiting should time out.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := WaitForCNPEnforced(ctx, cnp.Namespace, cnp.Name, cfg)
+	c.Assert(err, ErrorMatches, ".*to be enforced.*")
+
+	cnp.Status.Nodes["node1"] = v2.CiliumNetworkPolicyNodeStatus{OK: true, Enforcing: true}
+	_, err = ciliumNPClient.CiliumV2().CiliumNetworkPolicies(cnp.Namespace).UpdateStatus(context.TODO(), cnp, metav1.UpdateOptions{})
+	c.Assert(err, IsNil)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	c.Assert(WaitForCNPEnforced(ctx, cnp.Namespace, cnp.Name, cfg), IsNil)
+}
+
+func (k *K8sIntegrationSuite) TestListUnenforcedCNPs(c *C) {
+	enforced := &v2.CiliumNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "enforced", Namespace: "default"},
+		Status: v2.CiliumNetworkPolicyStatus{
+			Nodes: map[string]v2.CiliumNetworkPolicyNodeStatus{
+				"node1": {OK: true, Enforcing: true},
+			},
+		},
+	}
+	pending := &v2.CiliumNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default"},
+	}
+
+	ciliumNPClient := fake.NewSimpleClientset(enforced, pending)
+
+	unenforced, err := ciliumNPClient.CiliumV2().CiliumNetworkPolicies("default").ListUnenforced(context.TODO())
+	c.Assert(err, IsNil)
+	c.Assert(unenforced, HasLen, 1)
+	c.Assert(unenforced[0].Name, Equals, "pending")
+}
+
+func (k *K8sIntegrationSuite) TestMutateCNP(c *C) {
+	in := &v2.CiliumNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "mutate-test", Namespace: "default"},
+	}
+
+	out := typed_v2.MutateCNP(in, func(cnp *v2.CiliumNetworkPolicy) {
+		cnp.Labels = map[string]string{"mutated": "true"}
+	})
+
+	// The input, e.g. an object from a shared informer cache, is untouched.
+	c.Assert(in.Labels, HasLen, 0)
+	c.Assert(out.Labels, DeepEquals, map[string]string{"mutated": "true"})
+	c.Assert(out.Name, Equals, in.Name)
+}
+
+func (s *K8sIntegrationSuite) TestWatchCNPToHandler(c *C) {
+	client := fake.NewSimpleClientset(&v2.CiliumNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan typed_v2.CNPEvent, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.CiliumV2().CiliumNetworkPolicies("default").WatchCNPToHandler(ctx,
+			func(event typed_v2.CNPEvent) {
+				events <- event
+			})
+	}()
+
+	// The initial list is delivered as Added events.
+	select {
+	case event := <-events:
+		c.Assert(event.Type, Equals, watch.Added)
+		c.Assert(event.CNP.Name, Equals, "existing")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for initial event")
+	}
+
+	// Subsequent changes are streamed to the handler.
+	_, err := client.CiliumV2().CiliumNetworkPolicies("default").Create(ctx,
+		&v2.CiliumNetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "later", Namespace: "default"},
+		}, metav1.CreateOptions{})
+	c.Assert(err, IsNil)
+
+	select {
+	case event := <-events:
+		c.Assert(event.Type, Equals, watch.Added)
+		c.Assert(event.CNP.Name, Equals, "later")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for watch event")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		c.Assert(err, Equals, context.Canceled)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for watcher shutdown")
+	}
+}
@@ -272,7 +272,7 @@ func RegisterCRDs() error {
 		return fmt.Errorf("Unable to create rest configuration for k8s CRD: %s", err)
 	}
 
-	err = cilium_v2_client.CreateCustomResourceDefinitions(apiextensionsclientset)
+	err = cilium_v2_client.CreateCustomResourceDefinitions(context.TODO(), apiextensionsclientset)
 	if err != nil {
 		return fmt.Errorf("Unable to create custom resource definition: %s", err)
 	}
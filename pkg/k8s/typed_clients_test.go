@@ -0,0 +1,301 @@
+// Copyright 2020 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !privileged_tests
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	"github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/fake"
+
+	. "gopkg.in/check.v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+// TestCCNPTypedClient covers the cluster-scoped CiliumClusterwideNetworkPolicies
+// accessor of the typed clientset, including the status subresource.
+func (k *K8sIntegrationSuite) TestCCNPTypedClient(c *C) {
+	client := fake.NewSimpleClientset().CiliumV2()
+
+	ccnp := &v2.CiliumClusterwideNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "all-nodes",
+		},
+	}
+
+	created, err := client.CiliumClusterwideNetworkPolicies().Create(
+		context.TODO(), ccnp, metav1.CreateOptions{})
+	c.Assert(err, IsNil)
+
+	list, err := client.CiliumClusterwideNetworkPolicies().List(context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(list.Items, HasLen, 1)
+
+	// The CCNP status subresource is written per node, exercise it through
+	// UpdateStatus.
+	created.Status.Nodes = map[string]v2.CiliumNetworkPolicyNodeStatus{
+		"node1": {OK: true, Enforcing: true},
+	}
+	_, err = client.CiliumClusterwideNetworkPolicies().UpdateStatus(
+		context.TODO(), created, metav1.UpdateOptions{})
+	c.Assert(err, IsNil)
+
+	current, err := client.CiliumClusterwideNetworkPolicies().Get(
+		context.TODO(), "all-nodes", metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(current.Status.Nodes["node1"].Enforcing, Equals, true)
+
+	err = client.CiliumClusterwideNetworkPolicies().Delete(
+		context.TODO(), "all-nodes", metav1.DeleteOptions{})
+	c.Assert(err, IsNil)
+}
+
+// TestCEPTypedClient covers the namespaced CiliumEndpoints accessor of the
+// typed clientset, including the status subresource.
+func (k *K8sIntegrationSuite) TestCEPTypedClient(c *C) {
+	client := fake.NewSimpleClientset().CiliumV2()
+
+	cep := &v2.CiliumEndpoint{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod-1",
+			Namespace: "ns1",
+		},
+	}
+
+	created, err := client.CiliumEndpoints("ns1").Create(context.TODO(), cep, metav1.CreateOptions{})
+	c.Assert(err, IsNil)
+
+	// The endpoint is only visible in its own namespace.
+	list, err := client.CiliumEndpoints("ns1").List(context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(list.Items, HasLen, 1)
+
+	list, err = client.CiliumEndpoints("ns2").List(context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(list.Items, HasLen, 0)
+
+	created.Status.ID = 42
+	_, err = client.CiliumEndpoints("ns1").UpdateStatus(context.TODO(), created, metav1.UpdateOptions{})
+	c.Assert(err, IsNil)
+
+	current, err := client.CiliumEndpoints("ns1").Get(context.TODO(), "pod-1", metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(current.Status.ID, Equals, int64(42))
+}
+
+// TestCiliumNodeTypedClient covers the cluster-scoped CiliumNodes accessor of
+// the typed clientset, in particular patching, which IPAM integrations use to
+// avoid read-modify-write races on node status.
+func (k *K8sIntegrationSuite) TestCiliumNodeTypedClient(c *C) {
+	client := fake.NewSimpleClientset().CiliumV2()
+
+	node := &v2.CiliumNode{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-1",
+		},
+	}
+
+	_, err := client.CiliumNodes().Create(context.TODO(), node, metav1.CreateOptions{})
+	c.Assert(err, IsNil)
+
+	patch := []byte(`{"metadata":{"annotations":{"io.cilium.network.ipv4-pod-cidr":"10.0.0.0/24"}}}`)
+	patched, err := client.CiliumNodes().Patch(
+		context.TODO(), "node-1", k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(patched.Annotations["io.cilium.network.ipv4-pod-cidr"], Equals, "10.0.0.0/24")
+
+	current, err := client.CiliumNodes().Get(context.TODO(), "node-1", metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(current.Annotations["io.cilium.network.ipv4-pod-cidr"], Equals, "10.0.0.0/24")
+}
+
+// TestFakeClientsetReactors covers the error-injection workflow of the fake
+// clientset: seeding objects, failing selected verbs through a reactor and
+// asserting on the calls a controller made.
+func (k *K8sIntegrationSuite) TestFakeClientsetReactors(c *C) {
+	cnp := &v2.CiliumNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "policy-1",
+			Namespace: "ns1",
+		},
+	}
+
+	client := fake.NewSimpleClientset(cnp)
+	client.PrependReactor("update", "ciliumnetworkpolicies",
+		func(action k8sTesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("injected update failure")
+		})
+
+	seeded, err := client.CiliumV2().CiliumNetworkPolicies("ns1").Get(
+		context.TODO(), "policy-1", metav1.GetOptions{})
+	c.Assert(err, IsNil)
+
+	_, err = client.CiliumV2().CiliumNetworkPolicies("ns1").Update(
+		context.TODO(), seeded, metav1.UpdateOptions{})
+	c.Assert(err, ErrorMatches, "injected update failure")
+
+	// The recorded actions allow asserting exactly what a controller did.
+	updates := 0
+	for _, action := range client.Actions() {
+		if action.Matches("update", "ciliumnetworkpolicies") {
+			updates++
+		}
+	}
+	c.Assert(updates, Equals, 1)
+}
+
+// TestCiliumIdentityTypedClient covers the cluster-scoped CiliumIdentities
+// accessor of the typed clientset, in particular listing with a label
+// selector as used by identity audits.
+func (k *K8sIntegrationSuite) TestCiliumIdentityTypedClient(c *C) {
+	client := fake.NewSimpleClientset().CiliumV2()
+
+	for i, labels := range []map[string]string{
+		{"io.cilium.k8s.policy.cluster": "default"},
+		{"io.cilium.k8s.policy.cluster": "other"},
+	} {
+		identity := &v2.CiliumIdentity{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   fmt.Sprintf("%d", 1000+i),
+				Labels: labels,
+			},
+		}
+		_, err := client.CiliumIdentities().Create(context.TODO(), identity, metav1.CreateOptions{})
+		c.Assert(err, IsNil)
+	}
+
+	list, err := client.CiliumIdentities().List(context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(list.Items, HasLen, 2)
+
+	list, err = client.CiliumIdentities().List(context.TODO(), metav1.ListOptions{
+		LabelSelector: "io.cilium.k8s.policy.cluster=default",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(list.Items, HasLen, 1)
+	c.Assert(list.Items[0].Name, Equals, "1000")
+
+	current, err := client.CiliumIdentities().Get(context.TODO(), "1000", metav1.GetOptions{})
+	c.Assert(err, IsNil)
+
+	current.Labels["audited"] = "true"
+	_, err = client.CiliumIdentities().Update(context.TODO(), current, metav1.UpdateOptions{})
+	c.Assert(err, IsNil)
+
+	err = client.CiliumIdentities().Delete(context.TODO(), "1001", metav1.DeleteOptions{})
+	c.Assert(err, IsNil)
+
+	list, err = client.CiliumIdentities().List(context.TODO(), metav1.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(list.Items, HasLen, 1)
+}
+
+// TestCNPTypedClientPatch covers patching CiliumNetworkPolicies, including
+// the status subresource, which avoids read-modify-write races with the
+// agent updating the spec concurrently.
+func (k *K8sIntegrationSuite) TestCNPTypedClientPatch(c *C) {
+	cnp := &v2.CiliumNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "policy-1",
+			Namespace: "ns1",
+		},
+	}
+	client := fake.NewSimpleClientset(cnp).CiliumV2()
+
+	patch := []byte(`{"metadata":{"annotations":{"audit":"true"}}}`)
+	patched, err := client.CiliumNetworkPolicies("ns1").Patch(
+		context.TODO(), "policy-1", k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(patched.Annotations["audit"], Equals, "true")
+
+	// The subresources variadic routes the patch to /status.
+	statusPatch := []byte(`{"status":{"nodes":{"node1":{"ok":true,"enforcing":true}}}}`)
+	patched, err = client.CiliumNetworkPolicies("ns1").Patch(
+		context.TODO(), "policy-1", k8stypes.MergePatchType, statusPatch, metav1.PatchOptions{}, "status")
+	c.Assert(err, IsNil)
+	c.Assert(patched.Status.Nodes["node1"].OK, Equals, true)
+
+	current, err := client.CiliumNetworkPolicies("ns1").Get(context.TODO(), "policy-1", metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(current.Annotations["audit"], Equals, "true")
+	c.Assert(current.Status.Nodes["node1"].Enforcing, Equals, true)
+}
+
+// TestCNPWatchBookmarks verifies Bookmark events pass through the typed
+// CiliumNetworkPolicies watch untouched, so informers can advance their
+// resourceVersion during quiet periods.
+func (k *K8sIntegrationSuite) TestCNPWatchBookmarks(c *C) {
+	client := fake.NewSimpleClientset()
+
+	fw := watch.NewFake()
+	defer fw.Stop()
+	client.PrependWatchReactor("ciliumnetworkpolicies", k8sTesting.DefaultWatchReactor(fw, nil))
+
+	w, err := client.CiliumV2().CiliumNetworkPolicies("ns1").Watch(
+		context.TODO(), metav1.ListOptions{AllowWatchBookmarks: true})
+	c.Assert(err, IsNil)
+	defer w.Stop()
+
+	go fw.Action(watch.Bookmark, &v2.CiliumNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{ResourceVersion: "42"},
+	})
+
+	event := <-w.ResultChan()
+	c.Assert(event.Type, Equals, watch.Bookmark)
+	c.Assert(event.Object.(*v2.CiliumNetworkPolicy).ResourceVersion, Equals, "42")
+}
+
+// TestCNPTypedClientUpdateStatus covers the status subresource PUT of the
+// CiliumNetworkPolicies client and that the fake records it separately from
+// spec updates.
+func (k *K8sIntegrationSuite) TestCNPTypedClientUpdateStatus(c *C) {
+	cnp := &v2.CiliumNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "policy-1",
+			Namespace: "ns1",
+		},
+	}
+	client := fake.NewSimpleClientset(cnp)
+
+	seeded, err := client.CiliumV2().CiliumNetworkPolicies("ns1").Get(
+		context.TODO(), "policy-1", metav1.GetOptions{})
+	c.Assert(err, IsNil)
+
+	seeded.Status.Nodes = map[string]v2.CiliumNetworkPolicyNodeStatus{
+		"node1": {OK: true, Enforcing: true},
+	}
+	updated, err := client.CiliumV2().CiliumNetworkPolicies("ns1").UpdateStatus(
+		context.TODO(), seeded, metav1.UpdateOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(updated.Status.Nodes["node1"].OK, Equals, true)
+
+	// The recorded action targets the status subresource, distinguishing
+	// it from spec updates.
+	statusUpdates := 0
+	for _, action := range client.Actions() {
+		if action.Matches("update", "ciliumnetworkpolicies") &&
+			action.GetSubresource() == "status" {
+			statusUpdates++
+		}
+	}
+	c.Assert(statusUpdates, Equals, 1)
+}
@@ -56,6 +56,21 @@ type ServerCapabilities struct {
 	// This capability was introduced in K8s version 1.14, prior to which
 	// we don't support HA mode for the cilium-operator.
 	LeasesResourceLock bool
+
+	// StructuralSchemas is the ability of the apiserver to understand
+	// structural OpenAPI v3 schemas in CRDs, as required by the
+	// apiextensions v1 API. Introduced in K8s version 1.15.
+	StructuralSchemas bool
+
+	// ValidationRules is the ability of the apiserver to evaluate CEL
+	// x-kubernetes-validations expressions embedded in CRD schemas.
+	// Introduced in K8s version 1.23.
+	ValidationRules bool
+
+	// ServerSideApply is the ability of the apiserver to track field
+	// ownership and apply objects declaratively via PATCH with the apply
+	// patch type. GA since K8s version 1.16.
+	ServerSideApply bool
 }
 
 type cachedVersion struct {
@@ -83,6 +98,18 @@ var (
 	// Support for Lease resource was introduced in K8s version 1.14.
 	isGEThanLeaseSupportConstraint = versioncheck.MustCompile(">=1.14.0")
 
+	// Constraint to check support for structural schemas in CRDs, which
+	// the apiextensions v1 API requires. Introduced in K8s version 1.15.
+	isGEThanStructuralSchemaConstraint = versioncheck.MustCompile(">=1.15.0")
+
+	// Constraint to check support for CEL x-kubernetes-validations rules
+	// in CRD schemas. Introduced in K8s version 1.23.
+	isGEThanValidationRulesConstraint = versioncheck.MustCompile(">=1.23.0")
+
+	// Constraint to check support for server-side apply, which tracks
+	// field ownership on the apiserver. GA since K8s version 1.16.
+	isGEThanServerSideApplyConstraint = versioncheck.MustCompile(">=1.16.0")
+
 	// isGEThanMinimalVersionConstraint is the minimal version required to run
 	// Cilium
 	isGEThanMinimalVersionConstraint = versioncheck.MustCompile(">=" + MinimalVersionConstraint)
@@ -112,6 +139,9 @@ func updateVersion(version go_version.Version) {
 
 	cached.capabilities.Patch = option.Config.K8sForceJSONPatch || isGEThanPatchConstraint(version)
 	cached.capabilities.MinimalVersionMet = isGEThanMinimalVersionConstraint(version)
+	cached.capabilities.StructuralSchemas = isGEThanStructuralSchemaConstraint(version)
+	cached.capabilities.ValidationRules = isGEThanValidationRulesConstraint(version)
+	cached.capabilities.ServerSideApply = isGEThanServerSideApplyConstraint(version)
 }
 
 func updateServerGroupsAndResources(apiResourceLists []*metav1.APIResourceList) {